@@ -0,0 +1,240 @@
+package jupiter
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// A Permission says what a client of a Server can do
+type Permission int
+
+const (
+	PermNone  Permission = iota
+	PermRead             // read blocks and their types and sizes
+	PermWrite            // also write blocks and sync the store
+)
+
+var permissionNames = []string{"none", "read", "write"}
+
+func (p Permission) String() string {
+	if p >= 0 && int(p) < len(permissionNames) {
+		return permissionNames[p]
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+// ParsePermission returns the Permission with a given name:
+// "none", "read" or "write"
+func ParsePermission(s string) (Permission, error) {
+	for p, name := range permissionNames {
+		if s == name {
+			return Permission(p), nil
+		}
+	}
+	return PermNone, fmt.Errorf("unknown permission %q", s)
+}
+
+// AnyIdentity is the identity whose permissions apply to every client,
+// including the ones that are not authenticated
+const AnyIdentity = "*"
+
+// Auth has the clients allowed to use a Server or a Gateway.
+// Clients are identified by a pre-shared token or by the common name of
+// their TLS certificate.  A nil *Auth allows everything to everyone.
+type Auth struct {
+	Tokens      map[string]string     // identity of each token
+	Permissions map[string]Permission // of each identity, and of AnyIdentity
+}
+
+// Identify returns the identity of a token
+func (a *Auth) Identify(token string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	identity, found := "", false
+	// look at every token, so that the time taken does not tell
+	// which ones are close to the given one
+	for t, id := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			identity, found = id, true
+		}
+	}
+	return identity, found
+}
+
+// Permission returns the permission of an identity ("" for clients that
+// are not authenticated): the highest of its own and the one of AnyIdentity.
+func (a *Auth) Permission(identity string) Permission {
+	if a == nil {
+		return PermWrite
+	}
+	p := a.Permissions[AnyIdentity]
+	if identity != "" && a.Permissions[identity] > p {
+		p = a.Permissions[identity]
+	}
+	return p
+}
+
+// tlsIdentity returns the common name of the certificate of a TLS client,
+// or "" if it did not send one
+func tlsIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// identityKey is the key of the identity of a client in the context of
+// its HTTP requests
+type identityKey struct{}
+
+// requestIdentity returns the identity of the client of an HTTP request:
+// the one found by Auth.HTTPHandler, or else the common name of its
+// certificate, if any
+func requestIdentity(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey{}).(string); ok {
+		return id
+	}
+	return tlsIdentity(r.TLS)
+}
+
+// HTTPHandler returns a handler which checks the permissions of the
+// requests before passing them to h: GET and HEAD requests need to read,
+// and the others need to write.  Clients send their token as
+// "Authorization: Bearer token"; the connection of a request with an
+// invalid token is closed after the response.  The identity of the client
+// is passed to h in the context of the request.
+func (a *Auth) HTTPHandler(h http.Handler) http.Handler {
+	return a.httpHandler(h, nil)
+}
+
+// httpHandler is HTTPHandler, but the requests with an invalid token are
+// passed to allow, if not nil, with the identity of their client without
+// the token.  If it fails, the response is 429 Too Many Requests.
+func (a *Auth) httpHandler(h http.Handler, allow func(identity string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := tlsIdentity(r.TLS)
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			id, ok := "", false
+			if strings.HasPrefix(auth, "Bearer ") {
+				id, ok = a.Identify(strings.TrimPrefix(auth, "Bearer "))
+			}
+			if !ok {
+				w.Header().Set("Connection", "close")
+				if allow != nil {
+					if err := allow(identity); err != nil {
+						http.Error(w, err.Error(), http.StatusTooManyRequests)
+						return
+					}
+				}
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			identity = id
+		}
+		need := PermWrite
+		if r.Method == "GET" || r.Method == "HEAD" {
+			need = PermRead
+		}
+		if a.Permission(identity) < need {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+// Auth returns the clients allowed by a configuration, or nil if it has
+// no tokens or permissions
+func (c *Config) Auth() *Auth {
+	if len(c.Tokens) == 0 && len(c.Permissions) == 0 {
+		return nil
+	}
+	return &Auth{Tokens: c.Tokens, Permissions: c.Permissions}
+}
+
+// TLSConfig returns the TLS configuration of the servers in a
+// configuration, or nil if they do not use TLS.  Client certificates
+// are verified if there is a CA for them, but they are not required.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.TLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.TLSClientCA != "" {
+		if config.ClientCAs, err = loadCertPool(c.TLSClientCA); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// loadCertPool reads a file with PEM certificates
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s: no certificates found", filename)
+	}
+	return pool, nil
+}
+
+// ClientOptions are the options of a Conn or a Client
+type ClientOptions struct {
+	TLS   *tls.Config // if not nil, a Conn uses TLS, and a Client uses it for https URLs
+	Token string      // pre-shared token to authenticate with, if any
+}
+
+// ReplicaOptions returns the options to connect to the secondary at addr
+// in a configuration, or nil if it has none.
+func (c *Config) ReplicaOptions(addr string) (*ClientOptions, error) {
+	rc := c.ReplicaConfigs[addr]
+	if rc == nil {
+		return nil, nil
+	}
+	o := &ClientOptions{Token: rc.Token}
+	if rc.TLS {
+		var err error
+		if o.TLS, err = NewClientTLSConfig(rc.TLSCA, rc.TLSCert, rc.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// NewClientTLSConfig returns a TLS configuration for clients.  The server
+// certificate is verified with the CA in caFile, or with the ones of the
+// system if it is empty.  The client certificate is sent if certFile and
+// keyFile are not empty.
+func NewClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,280 @@
+package jupiter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadConfigAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("data data.log\ntoken s3cret alice\nallow alice write\nallow * read\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	a := c.Auth()
+	if id, ok := a.Identify("s3cret"); !ok || id != "alice" {
+		t.Errorf("Identify() = %q, %v", id, ok)
+	}
+	if _, ok := a.Identify("wrong"); ok {
+		t.Errorf("Identify() of a wrong token should fail")
+	}
+	if a.Permission("alice") != PermWrite || a.Permission("") != PermRead || a.Permission("bob") != PermRead {
+		t.Errorf("wrong permissions: %v", a.Permissions)
+	}
+
+	for _, bad := range []string{"token s3cret\n", "allow alice everything\n", "tlscert cert.pem\n", "replicatoken other:17034 s3cret\n"} {
+		ioutil.WriteFile(conf, []byte("data data.log\n"+bad), 0644)
+		if _, err := ReadConfig(conf); err == nil {
+			t.Errorf("ReadConfig() with %q should fail", bad)
+		}
+	}
+}
+
+func TestReadConfigReplicas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("data data.log\nreplica a:17034\nreplica b:17034\nreplicatoken a:17034 s3cret\nreplicatls a:17034 system\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	o, err := c.ReplicaOptions("a:17034")
+	if err != nil {
+		t.Fatalf("ReplicaOptions(): %v", err)
+	}
+	if o == nil || o.Token != "s3cret" || o.TLS == nil || o.TLS.RootCAs != nil {
+		t.Errorf("ReplicaOptions(a) = %+v", o)
+	}
+	if o, err := c.ReplicaOptions("b:17034"); o != nil || err != nil {
+		t.Errorf("ReplicaOptions(b) = %+v, %v, want nil", o, err)
+	}
+
+	ioutil.WriteFile(conf, []byte("data data.log\nreplica a:17034\nreplicatls a:17034 ca.pem\n"), 0644)
+	if c, err = ReadConfig(conf); err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	if rc := c.ReplicaConfigs["a:17034"]; rc.TLSCA != filepath.Join(dir, "ca.pem") {
+		t.Errorf("TLSCA = %q", rc.TLSCA)
+	}
+	if _, err := c.ReplicaOptions("a:17034"); err == nil {
+		t.Errorf("ReplicaOptions() with a missing CA should fail")
+	}
+}
+
+// newCert returns a certificate signed by parent (or self-signed if it is nil)
+func newCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServerAuth(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{newCert(t, "server", &ca)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := NewServer(j)
+	srv.Auth = &Auth{
+		Tokens:      map[string]string{"s3cret": "alice"},
+		Permissions: map[string]Permission{"alice": PermWrite, "bob": PermWrite, AnyIdentity: PermRead},
+	}
+	go srv.Serve(tls.NewListener(l, serverConfig))
+	addr := l.Addr().String()
+
+	// without a token or certificate, clients can only read
+	anon, err := DialWithOptions(addr, &ClientOptions{TLS: &tls.Config{RootCAs: pool}})
+	if err != nil {
+		t.Fatalf("DialWithOptions(): %v", err)
+	}
+	defer anon.Close()
+	if _, err := anon.Write(1, []byte("hello")); !errors.Is(err, ErrPermission) {
+		t.Errorf("Write() without permission: %v, want ErrPermission", err)
+	}
+	if _, _, err := anon.Read(ZeroScore); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read(): %v, want ErrNotFound", err)
+	}
+
+	// a wrong token is rejected
+	if _, err := DialWithOptions(addr, &ClientOptions{TLS: &tls.Config{RootCAs: pool}, Token: "wrong"}); !errors.Is(err, ErrPermission) {
+		t.Errorf("DialWithOptions() with a wrong token: %v, want ErrPermission", err)
+	}
+
+	// clients are identified by their token or by their certificate
+	for _, o := range []*ClientOptions{
+		{TLS: &tls.Config{RootCAs: pool}, Token: "s3cret"},
+		{TLS: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{newCert(t, "bob", &ca)}}},
+	} {
+		c, err := DialWithOptions(addr, o)
+		if err != nil {
+			t.Fatalf("DialWithOptions(): %v", err)
+		}
+		if _, err := c.Write(1, []byte("hello")); err != nil {
+			t.Errorf("Write() with permission: %v", err)
+		}
+		if err := c.Sync(); err != nil {
+			t.Errorf("Sync() with permission: %v", err)
+		}
+		c.Close()
+	}
+
+	// plain TCP connections fail
+	if c, err := Dial(addr); err == nil {
+		if _, _, err := c.Read(ZeroScore); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Read() without TLS: %v", err)
+		}
+		c.Close()
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	auth := &Auth{
+		Tokens:      map[string]string{"s3cret": "alice"},
+		Permissions: map[string]Permission{"alice": PermWrite, AnyIdentity: PermRead},
+	}
+	ts := httptest.NewServer(auth.HTTPHandler(NewGateway(j)))
+	defer ts.Close()
+
+	anon := NewClient(ts.URL)
+	if _, err := anon.Write(1, []byte("hello")); !errors.Is(err, ErrPermission) {
+		t.Errorf("Write() without permission: %v, want ErrPermission", err)
+	}
+	alice := NewClientWithOptions(ts.URL, &ClientOptions{Token: "s3cret"})
+	s, err := alice.Write(1, []byte("hello"))
+	if err != nil {
+		t.Fatalf("Write() with a token: %v", err)
+	}
+	if _, b, err := anon.Read(s); err != nil || string(b) != "hello" {
+		t.Errorf("Read() = %q, %v", b, err)
+	}
+	wrong := NewClientWithOptions(ts.URL, &ClientOptions{Token: "wrong"})
+	if _, _, err := wrong.Read(s); !errors.Is(err, ErrPermission) {
+		t.Errorf("Read() with a wrong token: %v, want ErrPermission", err)
+	}
+}
+
+func TestFailedAuth(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := NewServer(j)
+	srv.Auth = &Auth{
+		Tokens:      map[string]string{"s3cret": "alice"},
+		Permissions: map[string]Permission{AnyIdentity: PermRead},
+	}
+	srv.Limits = &Limits{RateLimits: map[string]float64{AnyIdentity: 2}}
+	go srv.Serve(l)
+	addr := l.Addr().String()
+
+	// the connection is closed after an invalid token
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := writeMessage(c, []byte{opAuth}, []byte("wrong")); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := readMessage(c); err != nil || resp[0] != statusDenied {
+		t.Errorf("response to an invalid token: %v, %v", resp, err)
+	}
+	if _, err := readMessage(c); err != io.EOF {
+		t.Errorf("connection after an invalid token: %v, want EOF", err)
+	}
+
+	// and failed attempts count for the rate limit
+	if _, err := DialWithOptions(addr, &ClientOptions{Token: "wrong"}); !errors.Is(err, ErrPermission) {
+		t.Errorf("DialWithOptions() with a wrong token: %v, want ErrPermission", err)
+	}
+	if _, err := DialWithOptions(addr, &ClientOptions{Token: "wrong"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("DialWithOptions() with a wrong token over the rate limit: %v, want ErrRateLimited", err)
+	}
+
+	// the same happens over HTTP
+	srv2 := NewServer(j)
+	srv2.Auth, srv2.Limits = srv.Auth, srv.Limits
+	ts := httptest.NewServer(srv2.HTTPHandler(NewGateway(j)))
+	defer ts.Close()
+	for i, code := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		r, _ := http.NewRequest("GET", ts.URL+"/block/"+ZeroScore.String(), nil)
+		r.Header.Set("Authorization", "Bearer wrong")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code || !resp.Close {
+			t.Errorf("request %d with a wrong token: %s (close %v), want %d", i, resp.Status, resp.Close, code)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package jupiter
 
 import (
+	"bufio"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 )
 
 const (
@@ -12,12 +16,54 @@ const (
 type BinHeap struct {
 	filename string
 	table    []uint32
+
+	// state of the index when the BinHeap was written
+	numBuckets uint32 // number of buckets in the index
+	indexed    uint64 // address in the data log of the first block not in the index
+	blocks     uint64 // number of blocks in the data log before indexed
+	bytes      uint64 // size of those blocks
 }
 
+// A BinHeap file has a header with a magic number ("Jhep"), a version
+// and the state of the index, followed by the entries in the table.
+// All the integers are big-endian.
+const (
+	binHeapMagic      = "Jhep"
+	binHeapVersion    = 1
+	binHeapHeaderSize = 4 + 4 + 4 + 8 + 8 + 8 + 4 // magic, version, numBuckets, indexed, blocks, bytes, table size
+)
+
 // OpenBinHeap opens a BinHeap stored in disk
-func OpenBinHeap(filename string) *BinHeap {
-	panic("OpenBinHeap(): not implemented")
-	return nil
+func OpenBinHeap(filename string) (*BinHeap, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < binHeapHeaderSize || string(b[:4]) != binHeapMagic {
+		return nil, fmt.Errorf("OpenBinHeap(%s): not a binary heap: %w", filename, ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint32(b[4:]); v != binHeapVersion {
+		return nil, fmt.Errorf("OpenBinHeap(%s): unsupported version %d", filename, v)
+	}
+	bh := &BinHeap{
+		filename:   filename,
+		numBuckets: binary.BigEndian.Uint32(b[8:]),
+		indexed:    binary.BigEndian.Uint64(b[12:]),
+		blocks:     binary.BigEndian.Uint64(b[20:]),
+		bytes:      binary.BigEndian.Uint64(b[28:]),
+	}
+	n := int(binary.BigEndian.Uint32(b[36:]))
+	if n == 0 || len(b) != binHeapHeaderSize+4*n {
+		return nil, fmt.Errorf("OpenBinHeap(%s): invalid size: %w", filename, ErrCorrupt)
+	}
+	bh.table = make([]uint32, n)
+	for i := range bh.table {
+		bh.table[i] = binary.BigEndian.Uint32(b[binHeapHeaderSize+4*i:])
+		if bh.table[i] != BHNotLeaf && bh.table[i] >= bh.numBuckets {
+			return nil, fmt.Errorf("OpenBinHeap(%s): entry %d points to bucket %d: %w", filename, i, bh.table[i], ErrCorrupt)
+		}
+	}
+	return bh, nil
 }
 
 // NewBinHeap creates a new binary heap, to be used as a hash function combined with an Index
@@ -25,6 +71,24 @@ func NewBinHeap(firstBucket uint32) (*BinHeap, error) {
 	return &BinHeap{table: []uint32{firstBucket}}, nil
 }
 
+// NewBinHeapPresplit creates a binary heap with a full tree of 2^bits leaves,
+// so that the first bits of a score choose its bucket.  allocate is called
+// once for each leaf, from left to right, and returns its bucket number.
+func NewBinHeapPresplit(bits int, allocate func() uint32) (*BinHeap, error) {
+	if bits < 0 || bits > maxInitialBits {
+		return nil, fmt.Errorf("NewBinHeapPresplit(%d): bits must be between 0 and %d", bits, maxInitialBits)
+	}
+	leaves := 1 << uint(bits)
+	bh := &BinHeap{table: make([]uint32, 2*leaves-1)}
+	for i := 0; i < leaves-1; i++ {
+		bh.table[i] = BHNotLeaf
+	}
+	for i := 0; i < leaves; i++ {
+		bh.table[leaves-1+i] = allocate()
+	}
+	return bh, nil
+}
+
 func isBitSet(b []byte, n int) bool {
 	if n >= 8 {
 		return isBitSet(b[n/8:], n%8)
@@ -32,13 +96,45 @@ func isBitSet(b []byte, n int) bool {
 	return (b[0]&(1<<(7-n)) != 0)
 }
 
+func setBit(b []byte, n int, v bool) {
+	if v {
+		b[n/8] |= 1 << (7 - n%8)
+	} else {
+		b[n/8] &^= 1 << (7 - n%8)
+	}
+}
+
+// Sync writes a BinHeap into its file, if it has one.  The file is replaced
+// atomically, so it always has a consistent state of the index.
 func (bh *BinHeap) Sync() error {
-	panic("BinHeap.Sync(): not implemented")
-	return nil
+	if bh.filename == "" {
+		return nil
+	}
+	tmp := bh.filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = bh.Write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("BinHeap.Sync(): %w", err)
+	}
+	return os.Rename(tmp, bh.filename)
 }
 
+// Close closes a BinHeap.  It does not write it: call Sync for that.
 func (bh *BinHeap) Close() error {
-	panic("BinHeap.Close(): not implemented")
 	return nil
 }
 
@@ -51,14 +147,37 @@ func (bh *BinHeap) Get(k int) (uint32, error) {
 }
 
 // GetBucket returns the entry in the binary heap table and the bucket number
-func (bh *BinHeap) GetBucket(s Score) (int, uint32) {
+func (bh *BinHeap) GetBucket(s Score) (int, uint32, error) {
 	i := 0
-	if len(bh.table) == 0 {
-		panic("BinHeap.GetBucket(): len(bh.table)=nil (should not happen")
+	for b := 0; b <= ScoreSize*8; b++ {
+		if i >= len(bh.table) {
+			break
+		}
+		if bh.table[i] != BHNotLeaf {
+			return i, bh.table[i], nil
+		}
+		if b == ScoreSize*8 {
+			break
+		}
+		if !isBitSet(s.s[:], b) {
+			i = i*2 + 1
+		} else {
+			i = i*2 + 2
+		}
 	}
-	for b := 0; ; b++ {
+	return 0, 0, fmt.Errorf("BinHeap.GetBucket(%s): no leaf found: %w", s, ErrCorrupt)
+}
+
+// GetBuckets returns the bucket numbers of all the leaves for the scores
+// whose first bits are the same as in s
+func (bh *BinHeap) GetBuckets(s Score, bits int) ([]uint32, error) {
+	i := 0
+	for b := 0; b < bits && b < ScoreSize*8; b++ {
+		if i >= len(bh.table) {
+			return nil, fmt.Errorf("BinHeap.GetBuckets(%s/%d): no leaf found: %w", s, bits, ErrCorrupt)
+		}
 		if bh.table[i] != BHNotLeaf {
-			return i, bh.table[i]
+			return []uint32{bh.table[i]}, nil
 		}
 		if !isBitSet(s.s[:], b) {
 			i = i*2 + 1
@@ -66,12 +185,58 @@ func (bh *BinHeap) GetBucket(s Score) (int, uint32) {
 			i = i*2 + 2
 		}
 	}
+	var buckets []uint32
+	var walk func(k int) error
+	walk = func(k int) error {
+		if k >= len(bh.table) {
+			return fmt.Errorf("BinHeap.GetBuckets(%s/%d): no leaf found: %w", s, bits, ErrCorrupt)
+		}
+		if bh.table[k] != BHNotLeaf {
+			buckets = append(buckets, bh.table[k])
+			return nil
+		}
+		if err := walk(2*k + 1); err != nil {
+			return err
+		}
+		return walk(2*k + 2)
+	}
+	if err := walk(i); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// Depth returns the length of the longest path from the root to a leaf
+func (bh *BinHeap) Depth() int {
+	var depth func(k int) int
+	depth = func(k int) int {
+		if k >= len(bh.table) || bh.table[k] != BHNotLeaf {
+			return 0
+		}
+		l, r := depth(2*k+1), depth(2*k+2)
+		if l > r {
+			return l + 1
+		}
+		return r + 1
+	}
+	return depth(0)
 }
 
 // Write stores a BinHeap into disk
 func (bh *BinHeap) Write(f io.Writer) error {
-	panic("BinHeap.Write(): not implemented")
-	return nil
+	b := make([]byte, binHeapHeaderSize, binHeapHeaderSize+4*len(bh.table))
+	copy(b, binHeapMagic)
+	binary.BigEndian.PutUint32(b[4:], binHeapVersion)
+	binary.BigEndian.PutUint32(b[8:], bh.numBuckets)
+	binary.BigEndian.PutUint64(b[12:], bh.indexed)
+	binary.BigEndian.PutUint64(b[20:], bh.blocks)
+	binary.BigEndian.PutUint64(b[28:], bh.bytes)
+	binary.BigEndian.PutUint32(b[36:], uint32(len(bh.table)))
+	for _, v := range bh.table {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	_, err := f.Write(b)
+	return err
 }
 
 // Set sets a new value 'v' for entry 'k' in the binary heap
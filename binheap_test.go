@@ -4,31 +4,25 @@ import (
 	"testing"
 )
 
-type newbucketer struct{}
-
-func (_ newbucketer) NewBucket(numScoreCommonBits int, scoreCommonBytes []byte) (uint32, error) {
-	return 0, nil
-}
-
 func TestBinHeap(t *testing.T) {
-	bh, err := NewBinHeap(newbucketer{})
+	bh, err := NewBinHeap(0)
 	if bh == nil || err != nil {
 		t.Errorf("error calling NewBinHeap()")
 	}
 	s1 := ZeroScore
 	s2 := GetScore([]byte{})
-	k, v := bh.GetBucket(s1)
-	t.Logf("GetBucket(s1) = (%d,%d)", k, v)
-	k, v = bh.GetBucket(s2)
-	t.Logf("GetBucket(s2) = (%d,%d)", k, v)
+	k, v, err := bh.GetBucket(s1)
+	t.Logf("GetBucket(s1) = (%d,%d,%v)", k, v, err)
+	k, v, err = bh.GetBucket(s2)
+	t.Logf("GetBucket(s2) = (%d,%d,%v)", k, v, err)
 	err = bh.NewLeaf(0, 1)
 	if err != nil {
 		t.Errorf("NewLeaf(0,1): %v", err)
 	}
-	k, v = bh.GetBucket(s1)
-	t.Logf("GetBucket(s1) = (%d,%d)", k, v)
-	k, v = bh.GetBucket(s2)
-	t.Logf("GetBucket(s2) = (%d,%d)", k, v)
+	k, v, err = bh.GetBucket(s1)
+	t.Logf("GetBucket(s1) = (%d,%d,%v)", k, v, err)
+	k, v, err = bh.GetBucket(s2)
+	t.Logf("GetBucket(s2) = (%d,%d,%v)", k, v, err)
 	err = bh.NewLeaf(0, 1)
 	if err == nil {
 		t.Errorf("NewLeaf(0,1): should return error")
@@ -41,10 +35,10 @@ func TestBinHeap(t *testing.T) {
 	if err != nil {
 		t.Errorf("NewLeaf(2,3): %v", err)
 	}
-	k, v = bh.GetBucket(s1)
-	t.Logf("GetBucket(s1) = (%d,%d)", k, v)
-	k, v = bh.GetBucket(s2)
-	t.Logf("GetBucket(s2) = (%d,%d)", k, v)
+	k, v, err = bh.GetBucket(s1)
+	t.Logf("GetBucket(s1) = (%d,%d,%v)", k, v, err)
+	k, v, err = bh.GetBucket(s2)
+	t.Logf("GetBucket(s2) = (%d,%d,%v)", k, v, err)
 	for i := 0; ; i++ {
 		v, err := bh.Get(i)
 		if err != nil {
@@ -53,3 +47,37 @@ func TestBinHeap(t *testing.T) {
 		t.Logf("Get(%d) = %d", i, v)
 	}
 }
+
+func TestBinHeapPresplit(t *testing.T) {
+	next := uint32(100)
+	bh, err := NewBinHeapPresplit(3, func() uint32 {
+		next++
+		return next - 1
+	})
+	if err != nil {
+		t.Fatalf("NewBinHeapPresplit(): %v", err)
+	}
+	if bh.Depth() != 3 || len(bh.table) != 15 {
+		t.Errorf("depth=%d size=%d, want 3 and 15", bh.Depth(), len(bh.table))
+	}
+	for i := 0; i < 8; i++ {
+		var s Score
+		s.s[0] = byte(i << 5)
+		if _, v, err := bh.GetBucket(s); err != nil || v != 100+uint32(i) {
+			t.Errorf("GetBucket(%02x...) = %d, %v, want %d", s.s[0], v, err, 100+i)
+		}
+	}
+	for _, c := range []struct {
+		first      byte
+		bits, want int
+	}{{0, 0, 8}, {0x80, 1, 4}, {0x40, 2, 2}, {0x40, 5, 1}} {
+		var s Score
+		s.s[0] = c.first
+		if buckets, err := bh.GetBuckets(s, c.bits); err != nil || len(buckets) != c.want {
+			t.Errorf("GetBuckets(%02x.../%d) = %v, %v, want %d buckets", c.first, c.bits, buckets, err, c.want)
+		}
+	}
+	if _, err := NewBinHeapPresplit(maxInitialBits+1, func() uint32 { return 0 }); err == nil {
+		t.Errorf("NewBinHeapPresplit() with too many bits should fail")
+	}
+}
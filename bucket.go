@@ -78,6 +78,7 @@ func (b *Bucket) Init(numScoreBytes int, numScoreCommonBits int, scoreCommonByte
 	b[1] = 'b'
 	b[2] = 'k'
 	b[3] = 't'
+	binary.BigEndian.PutUint16(b[bktNumEntries:bktNumEntries+2], 0)
 	b[bktNumAddressBytes] = 0
 	b[bktNumScoreBytes] = byte(numScoreBytes)
 	b[bktNumScoreCommonBits] = byte(numScoreCommonBits)
@@ -86,6 +87,26 @@ func (b *Bucket) Init(numScoreBytes int, numScoreCommonBits int, scoreCommonByte
 	}
 }
 
+// Check verifies that the header of a bucket is valid, so that its
+// entries can be read safely.
+func (b *Bucket) Check() error {
+	switch {
+	case string(b[0:4]) != "Jbkt":
+		return fmt.Errorf("bucket: bad magic number: %w", ErrCorrupt)
+	case b.numAddressBytes() > 8:
+		return fmt.Errorf("bucket: %d address bytes: %w", b.numAddressBytes(), ErrCorrupt)
+	case b.numScoreBytes() < 1 || b.numScoreBytes() > ScoreSize:
+		return fmt.Errorf("bucket: %d score bytes: %w", b.numScoreBytes(), ErrCorrupt)
+	case b.numScoreCommonBits() > b.numScoreBytes()*8:
+		return fmt.Errorf("bucket: %d common bits: %w", b.numScoreCommonBits(), ErrCorrupt)
+	case b.NumEntries() > 0 && b.entrySize() < 1:
+		return fmt.Errorf("bucket: entries of %d bytes: %w", b.entrySize(), ErrCorrupt)
+	case b.NumEntries() > 0 && b.NumEntries() > b.MaxEntries():
+		return fmt.Errorf("bucket: %d entries: %w", b.NumEntries(), ErrCorrupt)
+	}
+	return nil
+}
+
 func (b *Bucket) numAddressBytes() int {
 	return int(b[bktNumAddressBytes])
 }
@@ -119,6 +140,12 @@ func (b *Bucket) NumEntries() int {
 	return int(r)
 }
 
+// MaxEntries returns the number of entries that fit in a bucket
+// with its current layout
+func (b *Bucket) MaxEntries() int {
+	return (BlockSize - b.entryOffset()) / b.entrySize()
+}
+
 type Entry struct {
 	score Score
 	mask  int
@@ -170,11 +197,11 @@ func numBytesInUint64(a uint64) int {
 
 // Add adds an entry to a bucket, identified by a score, and points it to a given address.
 // It returns true if successful, false if there is no space in the bucket.
-func (b *Bucket) Add(s Score, a uint64) bool {
-	fmt.Printf("DEBUG: Bucket.Add(%s, %d)\n", s, a)
+// It is an error to add a score which does not belong in this bucket.
+func (b *Bucket) Add(s Score, a uint64) (bool, error) {
 	commonScore, mask := b.CommonScore()
 	if !s.Match(commonScore, mask) {
-		panic(fmt.Sprintf("Bucket.Add(): score %s outside of %s/%d", s, commonScore, mask))
+		return false, fmt.Errorf("Bucket.Add(): score %s outside of %s/%d", s, commonScore, mask)
 	}
 
 	numEntries := b.NumEntries()
@@ -185,17 +212,17 @@ func (b *Bucket) Add(s Score, a uint64) bool {
 		for i := 0; i < numEntries; i++ {
 			e := b.GetEntry(i)
 			if s.Match(e.score, e.mask) && a == e.addr {
-				return true
+				return true, nil
 			}
 		}
 	} else {
 		newEntrySize := numBytesInUint64(a) + b.numScoreBytes() - b.numScoreCommonBits()/8
 		if (numEntries+1)*newEntrySize > BlockSize-b.entryOffset() {
-			return false
+			return false, nil
+		}
+		if err := b.rebuild(numBytesInUint64(a), commonScore, mask); err != nil {
+			return false, err
 		}
-		// TODO: increment "numAddressBytes"
-		fmt.Printf("numAddressBytes=%d, a=%d\n", b.numAddressBytes(), a)
-		panic("Bucket.Add(): incrementing numAddressBytes: not implemented")
 	}
 	addressBytes := b.numAddressBytes()
 	scoreBytes := b.numScoreBytes()
@@ -206,7 +233,7 @@ func (b *Bucket) Add(s Score, a uint64) bool {
 	maxEntries := (BlockSize - b.entryOffset()) / entrySize
 	if maxEntries <= numEntries {
 		// not enough space to add the new score
-		return false
+		return false, nil
 	}
 	offset := b.entryOffset() + numEntries*entrySize
 
@@ -220,11 +247,81 @@ func (b *Bucket) Add(s Score, a uint64) bool {
 
 	// Increment NumEntries:
 	binary.BigEndian.PutUint16(b[bktNumEntries:bktNumEntries+2], uint16(numEntries+1))
-	return true
+	return true, nil
+}
+
+// entries returns a copy of all the entries stored in a bucket
+func (b *Bucket) entries() []Entry {
+	n := b.NumEntries()
+	result := make([]Entry, n)
+	for i := 0; i < n; i++ {
+		result[i] = *b.GetEntry(i)
+	}
+	return result
+}
+
+// rebuild re-initializes a bucket with a new number of address bytes and
+// a new set of common bits, keeping all its entries.
+// The caller must make sure all the entries fit in the new layout.
+func (b *Bucket) rebuild(numAddressBytes int, common Score, numScoreCommonBits int) error {
+	entries := b.entries()
+	b.Init(b.numScoreBytes(), numScoreCommonBits, common.s[:])
+	b[bktNumAddressBytes] = byte(numAddressBytes)
+	for _, e := range entries {
+		if _, err := b.Add(e.score, e.addr); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Split divides the entries in a bucket into two, in order to add a new bucket to an index.
+// b2 must be a fresh bucket with one more common bit than b, with that bit set.
+// After the split, b keeps the entries with that bit unset, and b2 the rest.
 func (b *Bucket) Split(b2 *Bucket) error {
-	panic("Bucket.Split(): not implemented")
+	common, mask := b.CommonScore()
+	common2, mask2 := b2.CommonScore()
+	if mask2 != mask+1 || !common.Match(common2, mask) || !isBitSet(common2.s[:], mask) {
+		return fmt.Errorf("Bucket.Split(): bucket %s/%d is not the upper half of %s/%d", common2, mask2, common, mask)
+	}
+	if mask2 > b.numScoreBytes()*8 {
+		return fmt.Errorf("Bucket.Split(): cannot split bucket %s/%d: no more bits in score: %w", common, mask, ErrIndexFull)
+	}
+	entries := b.entries()
+
+	// Build both halves apart, so that b and b2 are left untouched
+	// if any entry cannot be placed
+	lo, hi := new(Bucket), new(Bucket)
+	*hi = *b2
+	setBit(common.s[:], mask, false)
+	lo.Init(b.numScoreBytes(), mask2, common.s[:])
+	lo[bktNumAddressBytes] = byte(b.numAddressBytesFor(entries))
+	hi[bktNumAddressBytes] = lo[bktNumAddressBytes]
+	for _, e := range entries {
+		dst := lo
+		if isBitSet(e.score.s[:], mask) {
+			dst = hi
+		}
+		ok, err := dst.Add(e.score, e.addr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("Bucket.Split(): no room for entry %s", e.score)
+		}
+	}
+	*b, *b2 = *lo, *hi
 	return nil
 }
+
+// numAddressBytesFor returns the number of bytes needed to store
+// the addresses of a list of entries
+func (b *Bucket) numAddressBytesFor(entries []Entry) int {
+	n := b.numAddressBytes()
+	for _, e := range entries {
+		if numBytesInUint64(e.addr) > n {
+			n = numBytesInUint64(e.addr)
+		}
+	}
+	return n
+}
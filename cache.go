@@ -0,0 +1,76 @@
+package jupiter
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A BlockCache keeps in memory the most recently read blocks from a
+// BlockReader.  Blocks are immutable, so a cached block never becomes stale.
+// It is safe to use a BlockCache from several goroutines; calls to the
+// underlying BlockReader are serialized.
+type BlockCache struct {
+	r       BlockReader
+	maxSize int
+
+	mu     sync.Mutex
+	size   int
+	lru    *list.List // of *cacheEntry, most recently used first
+	blocks map[Score]*list.Element
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	score Score
+	t     Type
+	b     []byte
+}
+
+// NewBlockCache returns a BlockCache which holds up to maxSize bytes of data.
+func NewBlockCache(r BlockReader, maxSize int) *BlockCache {
+	return &BlockCache{
+		r:       r,
+		maxSize: maxSize,
+		lru:     list.New(),
+		blocks:  make(map[Score]*list.Element),
+	}
+}
+
+// Read returns a block, from the cache if possible.
+// The returned slice must not be modified.
+func (c *BlockCache) Read(score Score) (Type, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.blocks[score]; ok {
+		c.hits++
+		c.lru.MoveToFront(e)
+		ce := e.Value.(*cacheEntry)
+		return ce.t, ce.b, nil
+	}
+	c.misses++
+	t, b, err := c.r.Read(score)
+	if err != nil {
+		return t, b, err
+	}
+	if len(b) > c.maxSize {
+		return t, b, nil
+	}
+	c.blocks[score] = c.lru.PushFront(&cacheEntry{score: score, t: t, b: b})
+	c.size += len(b)
+	for c.size > c.maxSize {
+		e := c.lru.Back()
+		ce := e.Value.(*cacheEntry)
+		c.lru.Remove(e)
+		delete(c.blocks, ce.score)
+		c.size -= len(ce.b)
+	}
+	return t, b, nil
+}
+
+// Stats returns the number of cache hits and misses.
+func (c *BlockCache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,141 @@
+package jupiter
+
+import (
+	"fmt"
+)
+
+// A Chunker decides where to split a stream of data into blocks.
+type Chunker interface {
+	// Cut returns the length of the first chunk in b, or 0 if more
+	// data is needed to find the end of that chunk.
+	// It must return a value greater than 0 if len(b) >= MaxSize().
+	Cut(b []byte) int
+	// MaxSize returns the maximum size of a chunk.
+	MaxSize() int
+}
+
+// FixedChunker splits data in chunks of the same size.
+type FixedChunker struct {
+	Size int
+}
+
+func (c FixedChunker) Cut(b []byte) int {
+	if len(b) >= c.Size {
+		return c.Size
+	}
+	return 0
+}
+
+func (c FixedChunker) MaxSize() int {
+	return c.Size
+}
+
+// FastCDC is a content-defined chunker, using the FastCDC algorithm:
+// a gear-based rolling hash is computed over the data, and a chunk ends
+// when some bits of the hash are zero.  Because the boundaries depend
+// only on the data around them, inserting or removing bytes in a stream
+// only changes the chunks near the modification, and the rest of them
+// will be deduplicated.
+//
+// Chunks are never smaller than MinSize nor larger than MaxSize (except
+// the last one of a stream, which can be smaller), and their average
+// size is close to AvgSize.
+type FastCDC struct {
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // mask used before reaching avgSize (harder to match)
+	maskL   uint64 // mask used after reaching avgSize (easier to match)
+}
+
+// NewFastCDC returns a FastCDC chunker with the given sizes.
+// avg must be a power of 2, and min <= avg <= max <= MaxChunkSize.
+func NewFastCDC(min, avg, max int) (*FastCDC, error) {
+	bits := log2(avg)
+	if min <= 0 || min > avg || avg > max || max > MaxChunkSize || 1<<uint(bits) != avg || bits < 2 {
+		return nil, fmt.Errorf("NewFastCDC(%d,%d,%d): invalid sizes", min, avg, max)
+	}
+	return &FastCDC{
+		minSize: min,
+		avgSize: avg,
+		maxSize: max,
+		maskS:   topBits(bits + 1),
+		maskL:   topBits(bits - 1),
+	}, nil
+}
+
+// DefaultChunker returns a FastCDC chunker with an average chunk size of
+// ObjectBlockSize bytes.
+func DefaultChunker() *FastCDC {
+	c, _ := NewFastCDC(ObjectBlockSize/4, ObjectBlockSize, ObjectBlockSize*4)
+	return c
+}
+
+// log2 returns the smallest i such that 1<<i >= n
+func log2(n int) int {
+	i := 0
+	for n > 1<<uint(i) {
+		i++
+	}
+	return i
+}
+
+// topBits returns a mask with the n most significant bits set.
+// The gear hash is shifted left with every byte, so the higher bits
+// depend on more bytes than the lower ones.
+func topBits(n int) uint64 {
+	return ^uint64(0) << uint(64-n)
+}
+
+func (c *FastCDC) MaxSize() int {
+	return c.maxSize
+}
+
+func (c *FastCDC) Cut(b []byte) int {
+	if len(b) <= c.minSize {
+		return 0
+	}
+	n := len(b)
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	normal := c.avgSize
+	if normal > n {
+		normal = n
+	}
+	var hash uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gear[b[i]]
+		if hash&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = (hash << 1) + gear[b[i]]
+		if hash&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	if n == c.maxSize {
+		return n
+	}
+	return 0
+}
+
+// gear is the table of random values used by the rolling hash.
+// It must never change, or the chunk boundaries (and therefore the scores
+// of the blocks) of the same data would be different.
+var gear [256]uint64
+
+func init() {
+	// splitmix64, with a fixed seed
+	x := uint64(0x4a75706974657221) // "Jupiter!"
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
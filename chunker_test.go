@@ -0,0 +1,78 @@
+package jupiter
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFastCDC(t *testing.T) {
+	if _, err := NewFastCDC(100, 1000, 2000); err == nil {
+		t.Errorf("NewFastCDC() with avg not a power of 2 should return error")
+	}
+	c, err := NewFastCDC(256, 1024, 4096)
+	if err != nil {
+		t.Fatalf("NewFastCDC(): %v", err)
+	}
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	n := 0
+	for b := data; len(b) > 0; n++ {
+		l := c.Cut(b)
+		if l == 0 {
+			break
+		}
+		if l < 256 || l > 4096 {
+			t.Errorf("chunk of %d bytes", l)
+		}
+		b = b[l:]
+	}
+	if mean := len(data) / n; mean < 512 || mean > 2048 {
+		t.Errorf("mean chunk size is %d (should be close to 1024)", mean)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(2)).Read(data)
+	c, err := NewFastCDC(256, 1024, 4096)
+	if err != nil {
+		t.Fatalf("NewFastCDC(): %v", err)
+	}
+	w := NewObjectWriterChunker(j, c)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+
+	// insert some bytes near the start
+	data2 := append([]byte("some new bytes"), data...)
+	w = NewObjectWriterChunker(j, c)
+	if _, err := w.Write(data2); err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+	stats := w.Stats()
+	t.Log(stats)
+	if stats.Bytes != uint64(len(data2)) {
+		t.Errorf("Stats().Bytes = %d (should be %d)", stats.Bytes, len(data2))
+	}
+	if stats.StoredBytes > stats.Bytes/10 {
+		t.Errorf("stored %d bytes of %d (should be deduplicated)", stats.StoredBytes, stats.Bytes)
+	}
+
+	r, err := NewObjectReader(j, w.Score())
+	if err != nil {
+		t.Fatalf("NewObjectReader(): %v", err)
+	}
+	if r.Size() != int64(len(data2)) {
+		t.Errorf("Size() = %d (should be %d)", r.Size(), len(data2))
+	}
+}
@@ -0,0 +1,197 @@
+package jupiter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Client accesses the blocks of a remote Jupiter, served by a Gateway.
+// The methods with a context send its deadline, if any, to the Gateway,
+// and give up when the context is done.
+type Client struct {
+	url   string
+	http  *http.Client
+	token string
+}
+
+// NewClient returns a Client for the Gateway at a given address,
+// such as "localhost:8080" or "https://example.com/jupiter".
+func NewClient(addr string) *Client {
+	return NewClientWithOptions(addr, nil)
+}
+
+// NewClientWithOptions returns a Client which uses the TLS configuration
+// of the options for https URLs, and sends their token in every request.
+func NewClientWithOptions(addr string, o *ClientOptions) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	c := &Client{url: strings.TrimSuffix(addr, "/"), http: &http.Client{}}
+	if o != nil {
+		c.token = o.Token
+		if o.TLS != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = o.TLS
+			c.http.Transport = t
+		}
+	}
+	return c
+}
+
+// statusError converts the status of a response into an error
+func statusError(op string, resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	var err error
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err = ErrNotFound
+	case http.StatusConflict:
+		err = ErrTypeMismatch
+	case http.StatusRequestEntityTooLarge:
+		err = ErrTooLarge
+	case http.StatusGatewayTimeout:
+		err = context.DeadlineExceeded
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = ErrPermission
+	case http.StatusInsufficientStorage:
+		err = ErrQuotaExceeded
+	case http.StatusTooManyRequests:
+		err = ErrRateLimited
+	default:
+		err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return fmt.Errorf("jupiter: Client.%s: %w", op, err)
+}
+
+// do sends a request to the Gateway
+func (c *Client) do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+url, body)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		ms := time.Until(d) / time.Millisecond
+		if ms <= 0 {
+			return nil, fmt.Errorf("jupiter: Client: %s %s: %w", method, url, context.DeadlineExceeded)
+		}
+		req.Header.Set("X-Jupiter-Timeout", strconv.FormatInt(int64(ms), 10))
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// Read returns the type and contents of a block
+func (c *Client) Read(score Score) (Type, []byte, error) {
+	return c.ReadContext(context.Background(), score)
+}
+
+// ReadContext is like Read, with a context for the request
+func (c *Client) ReadContext(ctx context.Context, score Score) (Type, []byte, error) {
+	resp, err := c.do(ctx, "GET", "/block/"+score.String(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, statusError("Read("+score.String()+")", resp)
+	}
+	t, err := strconv.ParseUint(resp.Header.Get("X-Jupiter-Type"), 10, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("jupiter: Client.Read(%s): invalid type in response", score)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxChunkSize+1))
+	if err != nil {
+		return 0, nil, err
+	}
+	return Type(t), b, nil
+}
+
+// Stat returns the type and size of a block
+func (c *Client) Stat(score Score) (Type, int, error) {
+	return c.StatContext(context.Background(), score)
+}
+
+// StatContext is like Stat, with a context for the request
+func (c *Client) StatContext(ctx context.Context, score Score) (Type, int, error) {
+	resp, err := c.do(ctx, "HEAD", "/block/"+score.String(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, statusError("Stat("+score.String()+")", resp)
+	}
+	t, err := strconv.ParseUint(resp.Header.Get("X-Jupiter-Type"), 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("jupiter: Client.Stat(%s): invalid type in response", score)
+	}
+	size, err := strconv.Atoi(resp.Header.Get("Content-Length"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("jupiter: Client.Stat(%s): invalid size in response", score)
+	}
+	return Type(t), size, nil
+}
+
+// Has reports whether a block is stored.  Errors are reported as missing blocks.
+func (c *Client) Has(score Score) bool {
+	_, _, err := c.Stat(score)
+	return err == nil
+}
+
+// Write stores a block and returns its score
+func (c *Client) Write(t Type, b []byte) (Score, error) {
+	return c.WriteContext(context.Background(), t, b)
+}
+
+// WriteContext is like Write, with a context for the request
+func (c *Client) WriteContext(ctx context.Context, t Type, b []byte) (Score, error) {
+	if len(b) > MaxChunkSize {
+		return ZeroScore, fmt.Errorf("jupiter: Client.Write(): %d bytes: %w", len(b), ErrTooLarge)
+	}
+	resp, err := c.do(ctx, "PUT", fmt.Sprintf("/block?type=%d", t), bytes.NewReader(b))
+	if err != nil {
+		return ZeroScore, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return ZeroScore, statusError("Write()", resp)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return ZeroScore, err
+	}
+	return ParseScore(strings.TrimSpace(string(body)))
+}
+
+// Sync asks the server to commit its contents to stable storage
+func (c *Client) Sync() error {
+	return c.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, with a context for the request
+func (c *Client) SyncContext(ctx context.Context) error {
+	resp, err := c.do(ctx, "POST", "/sync", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError("Sync()", resp)
+	}
+	return nil
+}
+
+// Close closes the idle connections of a Client
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,120 @@
+package jupiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	ts := httptest.NewServer(NewGateway(j))
+	defer ts.Close()
+	c := NewClient(ts.URL)
+	defer c.Close()
+
+	s, err := c.Write(3, []byte("hello"))
+	if err != nil || !s.Equal(GetScore([]byte("hello"))) {
+		t.Fatalf("Write() = %s, %v", s, err)
+	}
+	typ, b, err := c.Read(s)
+	if err != nil || typ != 3 || string(b) != "hello" {
+		t.Errorf("Read() = %d, %q, %v", typ, b, err)
+	}
+	typ, size, err := c.Stat(s)
+	if err != nil || typ != 3 || size != 5 {
+		t.Errorf("Stat() = %d, %d, %v", typ, size, err)
+	}
+	if !c.Has(s) || c.Has(ZeroScore) {
+		t.Errorf("Has() is wrong")
+	}
+	if _, _, err := c.Read(ZeroScore); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read(missing): %v, want ErrNotFound", err)
+	}
+	if _, err := c.Write(4, []byte("hello")); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Write() with another type: %v, want ErrTypeMismatch", err)
+	}
+	if _, err := c.Write(4, make([]byte, MaxChunkSize+1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Write() of a big block: %v, want ErrTooLarge", err)
+	}
+	if err := c.Sync(); err != nil {
+		t.Errorf("Sync(): %v", err)
+	}
+
+	// objects can be read through a Client
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	w := NewObjectWriter(j)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewObjectReader(c, w.Score())
+	if err != nil {
+		t.Fatalf("NewObjectReader(): %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ObjectReader over a Client: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestStat(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	s, _ := j.Write(7, []byte("hello, world"))
+	if typ, size, err := j.Stat(s); err != nil || typ != 7 || size != 12 {
+		t.Errorf("Stat() = %d, %d, %v", typ, size, err)
+	}
+	if _, _, err := j.Stat(ZeroScore); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat(missing): %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	ts := httptest.NewServer(NewGateway(j))
+	defer ts.Close()
+	c := NewClient(ts.URL)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := c.WriteContext(ctx, 3, []byte("hello"))
+	if err != nil {
+		t.Fatalf("WriteContext() with a deadline: %v", err)
+	}
+	if typ, b, err := c.ReadContext(ctx, s); err != nil || typ != 3 || string(b) != "hello" {
+		t.Errorf("ReadContext() = %d, %q, %v", typ, b, err)
+	}
+
+	// the gateway gives up on a request whose deadline has passed
+	req, _ := http.NewRequest("GET", ts.URL+"/block/"+s.String(), nil)
+	req.Header.Set("X-Jupiter-Timeout", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("GET with an expired deadline: %s, want 504", resp.Status)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.ReadContext(ctx, s); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext() with a canceled context: %v", err)
+	}
+}
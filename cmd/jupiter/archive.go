@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cespedes/jupiter/vac"
+)
+
+func cmdArchive(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: archive <dir>")
+	}
+	j, _, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	w := vac.NewWriter(j)
+	score, err := w.Archive(args[0])
+	if err != nil {
+		return err
+	}
+	if err := j.Sync(); err != nil {
+		return err
+	}
+	fmt.Println(formatScore(j, score))
+	fmt.Fprintln(os.Stderr, w.Stats())
+	return nil
+}
+
+func cmdRestore(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: restore <score> <dir>")
+	}
+	j, _, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	score, err := j.ResolveScore(args[0])
+	if err != nil {
+		return err
+	}
+	return vac.Restore(j, score, args[1])
+}
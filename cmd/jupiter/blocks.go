@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cespedes/jupiter"
+)
+
+// A blockStore is a local Jupiter or a remote Client
+type blockStore interface {
+	Read(score jupiter.Score) (jupiter.Type, []byte, error)
+	Write(t jupiter.Type, b []byte) (jupiter.Score, error)
+	Stat(score jupiter.Score) (jupiter.Type, int, error)
+	Has(score jupiter.Score) bool
+	Close() error
+}
+
+// openBlockStore opens the remote store given with -s, or else the local one.
+// Remote stores are reached with the TCP protocol, or through the HTTP
+// gateway if the address is a URL.
+func openBlockStore() (blockStore, error) {
+	if *server != "" {
+		o, err := clientOptions()
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(*server, "://") {
+			return jupiter.NewClientWithOptions(*server, o), nil
+		}
+		return jupiter.DialWithOptions(*server, o)
+	}
+	j, _, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// clientOptions returns the options to connect to a remote store.
+// TLS is used with the TCP protocol if any of the TLS flags is given.
+func clientOptions() (*jupiter.ClientOptions, error) {
+	o := &jupiter.ClientOptions{Token: *token}
+	if *useTLS || *tlsCA != "" || *tlsCert != "" || strings.HasPrefix(*server, "https://") {
+		config, err := jupiter.NewClientTLSConfig(*tlsCA, *tlsCert, *tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		o.TLS = config
+	}
+	return o, nil
+}
+
+// resolveScore reads a score from the command line.  Local stores also
+// accept abbreviated scores.
+func resolveScore(s blockStore, arg string) (jupiter.Score, error) {
+	if j, ok := s.(*jupiter.Jupiter); ok {
+		return j.ResolveScore(arg)
+	}
+	return jupiter.ParseScore(arg)
+}
+
+// formatScore returns a score as it is printed: tagged with its hash
+// algorithm if -tag was given and the store knows it
+func formatScore(s interface{}, score jupiter.Score) string {
+	if x, ok := s.(interface{ Hasher() jupiter.Hasher }); ok && *tagScores {
+		return jupiter.TagScore(x.Hasher(), score)
+	}
+	return score.String()
+}
+
+func cmdPut(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	t := fs.Uint("t", 0, "type of the block")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *t > 255 {
+		return errors.New("usage: put [-t type] < file")
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(os.Stdin, jupiter.MaxChunkSize+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > jupiter.MaxChunkSize {
+		return fmt.Errorf("input is larger than %d bytes: %w", jupiter.MaxChunkSize, jupiter.ErrTooLarge)
+	}
+	s, err := openBlockStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	score, err := s.Write(jupiter.Type(*t), b)
+	if err != nil {
+		return err
+	}
+	if j, ok := s.(*jupiter.Jupiter); ok {
+		if err := j.Sync(); err != nil {
+			return err
+		}
+	}
+	fmt.Println(formatScore(s, score))
+	return nil
+}
+
+// withScore opens the store and resolves the only argument of a command
+func withScore(usage string, args []string, fn func(s blockStore, score jupiter.Score) error) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + usage)
+	}
+	s, err := openBlockStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	score, err := resolveScore(s, args[0])
+	if err != nil {
+		return err
+	}
+	return fn(s, score)
+}
+
+func cmdGet(args []string) error {
+	return withScore("get <score>", args, func(s blockStore, score jupiter.Score) error {
+		_, b, err := s.Read(score)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	})
+}
+
+func cmdHas(args []string) error {
+	return withScore("has <score>", args, func(s blockStore, score jupiter.Score) error {
+		_, _, err := s.Stat(score)
+		return err
+	})
+}
+
+func cmdStat(args []string) error {
+	return withScore("stat <score>", args, func(s blockStore, score jupiter.Score) error {
+		t, size, err := s.Stat(score)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s type=%d size=%d\n", formatScore(s, score), t, size)
+		return nil
+	})
+}
+
+func cmdCatTree(args []string) error {
+	return withScore("cat-tree <score>", args, func(s blockStore, score jupiter.Score) error {
+		r, err := jupiter.NewObjectReader(s, score)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(os.Stdout, r)
+		return err
+	})
+}
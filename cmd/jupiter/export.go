@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cespedes/jupiter"
+	"github.com/cespedes/jupiter/vac"
+)
+
+// cmdExport writes the trees with the given roots to the standard output.
+// Snapshots made with archive are exported with all their files.
+func cmdExport(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: export <score>... > file")
+	}
+	s, err := openBlockStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	var roots []jupiter.Score
+	for _, arg := range args {
+		score, err := resolveScore(s, arg)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, score)
+	}
+	e, err := jupiter.NewExporter(os.Stdout, s)
+	if err != nil {
+		return err
+	}
+	for _, score := range roots {
+		t, _, err := s.Stat(score)
+		if err != nil {
+			return err
+		}
+		if t == vac.RootType {
+			err = vac.Export(e, s, score)
+		} else {
+			err = e.WriteBlock(score)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d blocks exported\n", e.Blocks())
+	return nil
+}
+
+func cmdImport(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: import < file")
+	}
+	s, err := openBlockStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	stats, err := jupiter.Import(os.Stdin, s)
+	if x, ok := s.(interface{ Sync() error }); ok && err == nil {
+		err = x.Sync()
+	}
+	fmt.Fprintln(os.Stderr, stats)
+	return err
+}
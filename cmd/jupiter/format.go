@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cespedes/jupiter"
+)
+
+func cmdFormat(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: format")
+	}
+	c, err := config()
+	if err != nil {
+		return err
+	}
+	if err := jupiter.Format(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "formatted %s with %d buckets\n", c.DataLogFiles[0], c.InitialBuckets)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/cespedes/jupiter"
+)
+
+func cmdHTTP(args []string) error {
+	fs := flag.NewFlagSet("http", flag.ExitOnError)
+	addr := fs.String("a", "", "listen address (default: the http port in the configuration)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return errors.New("usage: http [-a addr]")
+	}
+	j, c, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	if *addr == "" {
+		if c.HTTPPort == 0 {
+			return errors.New("no http port in configuration")
+		}
+		*addr = fmt.Sprintf(":%d", c.HTTPPort)
+	}
+	mux, _ := jupiter.NewHTTPHandler(j)
+	return http.ListenAndServe(*addr, mux)
+}
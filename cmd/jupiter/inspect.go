@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/cespedes/jupiter"
+)
+
+const inspectUsage = "usage: inspect heap | bucket <n> | log [-from addr] | lookup <score>"
+
+// cmdInspect prints the internal structures of a local store as they are
+// in disk: the store is opened read-only, so the blocks written after the
+// last sync are not in the index, and invalid buckets are not reset.
+func cmdInspect(args []string) error {
+	if len(args) == 0 {
+		return errors.New(inspectUsage)
+	}
+	var fn func(j *jupiter.Jupiter, args []string) error
+	switch args[0] {
+	case "heap":
+		fn = inspectHeap
+	case "bucket":
+		fn = inspectBucket
+	case "log":
+		fn = inspectLog
+	case "lookup":
+		fn = inspectLookup
+	default:
+		return errors.New(inspectUsage)
+	}
+	j, err := openStoreReadOnly()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	return fn(j, args[1:])
+}
+
+// fill returns the number of entries in a bucket and how full it is
+func fill(b *jupiter.Bucket) string {
+	return fmt.Sprintf("%d/%d (%.0f%%)", b.NumEntries(), b.MaxEntries(), 100*float64(b.NumEntries())/float64(b.MaxEntries()))
+}
+
+func inspectHeap(j *jupiter.Jupiter, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: inspect heap")
+	}
+	return j.Inspect(func(bh *jupiter.BinHeap, in *jupiter.Index, d *jupiter.DataLog) error {
+		fmt.Printf("depth=%d buckets=%d\n", bh.Depth(), in.NumBuckets())
+		return bh.Leaves(func(k int, prefix string, n uint32) error {
+			if prefix == "" {
+				prefix = "-"
+			}
+			b, err := in.Bucket(n)
+			if err != nil {
+				fmt.Printf("%-24s bucket=%d %v\n", prefix, n, err)
+				return nil
+			}
+			fmt.Printf("%-24s bucket=%d entries=%s\n", prefix, n, fill(b))
+			return nil
+		})
+	})
+}
+
+func inspectBucket(j *jupiter.Jupiter, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: inspect bucket <n>")
+	}
+	n, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return err
+	}
+	return j.Inspect(func(bh *jupiter.BinHeap, in *jupiter.Index, d *jupiter.DataLog) error {
+		b := in.RawBucket(uint32(n))
+		if b == nil {
+			return fmt.Errorf("bucket %d: %w", n, jupiter.ErrNotFound)
+		}
+		h := b.Header()
+		err := b.Check()
+		if err == nil {
+			fmt.Printf("bucket=%d entries=%s\n", n, fill(b))
+		} else {
+			// the entries of an invalid bucket are printed as they are stored
+			fmt.Printf("bucket=%d magic=%q entries=%d invalid: %v\n", n, b[:4], h.NumEntries, err)
+		}
+		fmt.Printf("numAddressBytes=%d numScoreBytes=%d\n", h.NumAddressBytes, h.NumScoreBytes)
+		fmt.Printf("CommonScore=%s bits=%d\n", h.CommonScore.Prefix(h.NumScoreCommonBits), h.NumScoreCommonBits)
+		if err != nil {
+			for i, e := range b.RawEntries() {
+				fmt.Printf("%5d %x addr=%d\n", i, e.Score, e.Addr)
+			}
+			return err
+		}
+		for i := 0; i < h.NumEntries; i++ {
+			e := b.GetEntry(i)
+			s, bits := e.Score()
+			fmt.Printf("%5d %s addr=%d\n", i, s.Prefix(bits), e.Addr())
+		}
+		return nil
+	})
+}
+
+func inspectLog(j *jupiter.Jupiter, args []string) error {
+	fs := flag.NewFlagSet("inspect log", flag.ExitOnError)
+	from := fs.Uint64("from", 0, "address of the first block")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return errors.New("usage: inspect log [-from addr]")
+	}
+	return j.Inspect(func(bh *jupiter.BinHeap, in *jupiter.Index, d *jupiter.DataLog) error {
+		size, err := d.Size()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("hash=%s size=%d\n", d.Hasher().Name(), size)
+		return d.Walk(*from, func(addr uint64, s jupiter.Score, t jupiter.Type, size int) error {
+			fmt.Printf("%d %s type=%d size=%d\n", addr, s, t, size)
+			return nil
+		})
+	})
+}
+
+func inspectLookup(j *jupiter.Jupiter, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: inspect lookup <score>")
+	}
+	// a full score is looked up even if the block is not found
+	score, err := jupiter.ParseScore(args[0])
+	if err != nil {
+		if score, err = j.ResolveScore(args[0]); err != nil {
+			return err
+		}
+	}
+	t, err := j.Lookup(score)
+	fmt.Printf("score=%s\n", score)
+	for i, k := range t.Path {
+		bits := bitString(score, i)
+		if bits == "" {
+			bits = "-"
+		}
+		fmt.Printf("heap[%d] bits=%s\n", k, bits)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bucket=%d candidates=%d\n", t.Bucket, len(t.Candidates))
+	for _, c := range t.Candidates {
+		var cerr *jupiter.CorruptionError
+		switch {
+		case c.Err == nil:
+			fmt.Printf("addr=%d found\n", c.Addr)
+		case errors.Is(c.Err, jupiter.ErrNotFound):
+			fmt.Printf("addr=%d false positive (block %s)\n", c.Addr, c.Score)
+		case errors.As(c.Err, &cerr):
+			fmt.Printf("addr=%d corrupt: %s\n", c.Addr, cerr.Reason)
+		default:
+			fmt.Printf("addr=%d error: %v\n", c.Addr, c.Err)
+		}
+	}
+	if !t.Found() {
+		return fmt.Errorf("%s: %w", score, jupiter.ErrNotFound)
+	}
+	return nil
+}
+
+// bitString returns the first n bits of a score as a string of '0' and '1'
+func bitString(s jupiter.Score, n int) string {
+	b := s.Bytes()
+	r := make([]byte, n)
+	for i := range r {
+		r[i] = '0' + b[i/8]>>(7-uint(i%8))&1
+	}
+	return string(r)
+}
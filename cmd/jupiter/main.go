@@ -1,37 +1,155 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/cespedes/jupiter"
 )
 
+var (
+	configFile = flag.String("c", "jupiter.conf", "configuration file")
+	storeDir   = flag.String("d", "", "store directory (instead of a configuration file)")
+	server     = flag.String("s", os.Getenv("JUPITER_SERVER"), "address of a remote server, or URL of an HTTP gateway (default $JUPITER_SERVER)")
+	verbose    = flag.Bool("v", false, "log debugging messages")
+	tagScores  = flag.Bool("tag", false, "print the scores of local stores tagged with their hash algorithm")
+
+	token   = flag.String("token", os.Getenv("JUPITER_TOKEN"), "token to authenticate with the server (default $JUPITER_TOKEN)")
+	useTLS  = flag.Bool("tls", false, "use TLS with the TCP protocol")
+	tlsCA   = flag.String("tlsca", "", "CA of the server certificate (default: the ones of the system)")
+	tlsCert = flag.String("tlscert", "", "client certificate, for TLS")
+	tlsKey  = flag.String("tlskey", "", "key of the client certificate")
+)
+
+// Exit codes
+const (
+	exitOK       = 0
+	exitNotFound = 1 // a block was not found
+	exitError    = 2
+)
+
+var commands = map[string]func(args []string) error{
+	"format":   cmdFormat,
+	"put":      cmdPut,
+	"get":      cmdGet,
+	"has":      cmdHas,
+	"stat":     cmdStat,
+	"cat-tree": cmdCatTree,
+	"inspect":  cmdInspect,
+	"verify":   cmdVerify,
+	"simulate": cmdSimulate,
+	"export":   cmdExport,
+	"import":   cmdImport,
+	"archive":  cmdArchive,
+	"restore":  cmdRestore,
+	"9p":       cmd9P,
+	"http":     cmdHTTP,
+}
+
+// creates are the commands which create the store given with -d if it
+// does not exist.  The others fail instead of using an empty store.
+var creates = map[string]bool{
+	"format":  true,
+	"put":     true,
+	"import":  true,
+	"archive": true,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-v] [-tag] [-c config | -d dir | -s addr] command [args...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  format                   create the files of a new store\n")
+	fmt.Fprintf(os.Stderr, "  put [-t type] < file     store a block and print its score\n")
+	fmt.Fprintf(os.Stderr, "  get <score> > file       write the contents of a block\n")
+	fmt.Fprintf(os.Stderr, "  has <score>              check if a block is stored\n")
+	fmt.Fprintf(os.Stderr, "  stat <score>             print the type and size of a block\n")
+	fmt.Fprintf(os.Stderr, "  cat-tree <score> > file  write the contents of an object\n")
+	fmt.Fprintf(os.Stderr, "  export <score>... > file write trees and snapshots as a stream of blocks\n")
+	fmt.Fprintf(os.Stderr, "  import < file            store the blocks in a stream made by export\n")
+	fmt.Fprintf(os.Stderr, "  inspect <what> [args]   print the heap, a bucket, the data log or a lookup\n")
+	fmt.Fprintf(os.Stderr, "  verify [-timeout d]      check every block in the data log and the index\n")
+	fmt.Fprintf(os.Stderr, "  simulate [-n blocks]     fill an index with random scores and print its statistics\n")
+	fmt.Fprintf(os.Stderr, "  archive <dir>            store a directory tree and print its score\n")
+	fmt.Fprintf(os.Stderr, "  restore <score> <dir>    extract a directory tree\n")
+	fmt.Fprintf(os.Stderr, "  9p [-a addr] <score>     serve a directory tree with 9P2000\n")
+	fmt.Fprintf(os.Stderr, "  http [-a addr]           serve blocks, objects and stats over HTTP\n")
+	fmt.Fprintf(os.Stderr, "\nScores can be abbreviated when using a local store, and tagged with the name\n")
+	fmt.Fprintf(os.Stderr, "of their hash algorithm (such as sha256:1f8a...), as printed with -tag.\n")
+	fmt.Fprintf(os.Stderr, "The exit status is 0 on success, %d if a block is not found and %d on other errors.\n", exitNotFound, exitError)
+	flag.PrintDefaults()
+}
+
 func main() {
-	fmt.Println("Starting Jupiter")
-	j, err := jupiter.New()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	scores := []jupiter.Score{}
-	fmt.Printf("Writing %d blocks...\n", len(os.Args)-1)
-	for i := 1; i < len(os.Args); i++ {
-		fmt.Printf("Writing %q...\n", os.Args[i])
-		score, err := j.Write(0, []byte(os.Args[i]))
-		if err != nil {
-			fmt.Printf("Error writing arg %d (%q): %s\n", i, os.Args[i], err)
+	flag.Usage = usage
+	flag.Parse()
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(exitError)
+	}
+	if err := cmd(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "jupiter %s: %v\n", flag.Arg(0), err)
+		if errors.Is(err, jupiter.ErrNotFound) {
+			os.Exit(exitNotFound)
 		}
-		scores = append(scores, score)
-		fmt.Printf("Arg %d (%q): score=%s\n", i, os.Args[i], score)
-	}
-	fmt.Printf("Reading %d blocks...\n", len(os.Args)-1)
-	for i := 0; i < len(os.Args)-1; i++ {
-		fmt.Printf("Reading %s...\n", scores[i])
-		t, b, err := j.Read(scores[i])
-		if err != nil {
-			fmt.Printf("Error reading: %s\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// config returns the configuration of the local store: the one in the
+// store directory given with -d, or the configuration file given with -c.
+// A store directory without a configuration file has a single data log.
+func config() (*jupiter.Config, error) {
+	if *storeDir == "" {
+		return jupiter.ReadConfig(*configFile)
+	}
+	conf := filepath.Join(*storeDir, "jupiter.conf")
+	if _, err := os.Stat(conf); err == nil {
+		return jupiter.ReadConfig(conf)
+	}
+	c := &jupiter.Config{
+		BucketSize:   jupiter.BlockSize,
+		FPSize:       jupiter.ScoreBytesInEntry,
+		DataLogFiles: []string{filepath.Join(*storeDir, "data.log")},
+	}
+	if creates[flag.Arg(0)] {
+		if err := os.MkdirAll(*storeDir, 0777); err != nil {
+			return nil, err
 		}
-		fmt.Printf("score %s: type=%d len=%d data=%q\n", scores[i], t, len(b), b)
+	} else if _, err := os.Stat(c.DataLogFiles[0]); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: no such store", *storeDir)
+	}
+	return c, nil
+}
+
+// openStore opens the local Jupiter
+func openStore() (*jupiter.Jupiter, *jupiter.Config, error) {
+	c, err := config()
+	if err != nil {
+		return nil, nil, err
+	}
+	level := jupiter.LevelWarn
+	if *verbose {
+		level = jupiter.LevelDebug
+	}
+	c.Logger = jupiter.NewTextLogger(os.Stderr, level)
+	j, err := jupiter.Open(c)
+	return j, c, err
+}
+
+// openStoreReadOnly opens the local Jupiter without modifying its files
+func openStoreReadOnly() (*jupiter.Jupiter, error) {
+	c, err := config()
+	if err != nil {
+		return nil, err
+	}
+	level := jupiter.LevelWarn
+	if *verbose {
+		level = jupiter.LevelDebug
 	}
+	c.Logger = jupiter.NewTextLogger(os.Stderr, level)
+	return jupiter.OpenReadOnly(c)
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/cespedes/jupiter"
+)
+
+func cmdSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var s jupiter.Simulation
+	fs.IntVar(&s.Blocks, "n", 100000, "number of blocks")
+	fs.IntVar(&s.Lookups, "lookups", 10000, "number of lookups of missing blocks")
+	fs.IntVar(&s.BucketSize, "bucketsize", jupiter.BlockSize, "size of each bucket in bytes")
+	fs.IntVar(&s.FPSize, "fpsize", jupiter.ScoreBytesInEntry, "bytes of the score in each entry")
+	fs.IntVar(&s.InitialBuckets, "initialbuckets", 1, "number of buckets in a new index")
+	fs.IntVar(&s.AddressBytes, "addrbytes", 5, "bytes of the address in each entry")
+	fs.Int64Var(&s.Seed, "seed", 1, "seed for the random scores")
+	blockSize := fs.Int("blocksize", 8192, "mean size of the blocks, to project the size of the index")
+	fs.Parse(args)
+	if fs.NArg() != 0 || s.Blocks < 1 || *blockSize < 1 {
+		return errors.New("usage: simulate [-n blocks] [-lookups n] [-bucketsize size] [-fpsize size] [-initialbuckets n] [-addrbytes n] [-blocksize size] [-seed n]")
+	}
+	r, err := s.Run()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("blocks=%d buckets=%d depth=%d\n", s.Blocks, r.Buckets, r.BinHeapDepth)
+	fmt.Printf("fill min=%.1f%% mean=%.1f%% max=%.1f%%\n", 100*r.MinFill, 100*r.MeanFill, 100*r.MaxFill)
+	for i, n := range r.BucketFill {
+		fmt.Printf("  %3d-%3d%% %d\n", i*100/len(r.BucketFill), (i+1)*100/len(r.BucketFill), n)
+	}
+	fmt.Printf("false positives=%d/%d (%.4f%%) extra reads=%d\n", r.FalsePositives, r.Lookups, 100*r.FalsePositiveRate(), r.Candidates)
+	size := r.IndexBytes + r.BinHeapBytes
+	data := float64(s.Blocks) * float64(*blockSize)
+	fmt.Printf("index=%d bytes heap=%d bytes (%.2f GB per TB of %d-byte blocks)\n", r.IndexBytes, r.BinHeapBytes, float64(size)/data*1000, *blockSize)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/cespedes/jupiter"
+	"github.com/cespedes/jupiter/vacfs"
+)
+
+func cmd9P(args []string) error {
+	fs := flag.NewFlagSet("9p", flag.ExitOnError)
+	addr := fs.String("a", ":5640", "listen address")
+	cacheSize := fs.Int("cache", 64, "size of the block cache, in MB")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: 9p [-a addr] [-cache MB] <score>")
+	}
+	j, c, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	score, err := j.ResolveScore(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	cache := jupiter.NewBlockCache(j, *cacheSize<<20)
+	s, err := vacfs.NewServer(cache, score)
+	if err != nil {
+		return err
+	}
+	if c.HTTPPort != 0 {
+		mux, stats := jupiter.NewHTTPHandler(j)
+		stats.AddCache("9p", cache)
+		go func() {
+			log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", c.HTTPPort), mux))
+		}()
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
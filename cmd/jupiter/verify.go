@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/cespedes/jupiter"
+)
+
+func cmdVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 0, "stop after this time (default: no limit)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return errors.New("usage: verify [-timeout duration]")
+	}
+	j, _, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+	go func() {
+		select {
+		case <-sigc:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	res, err := j.Verify(ctx)
+	for _, c := range res.Corrupt {
+		fmt.Println(c)
+	}
+	fmt.Printf("%d blocks, %d bytes checked in %v: %d problems\n", res.Blocks, res.Bytes, time.Since(start).Round(time.Millisecond), len(res.Corrupt))
+	if err != nil {
+		return err
+	}
+	if len(res.Corrupt) > 0 {
+		return jupiter.ErrCorrupt
+	}
+	return nil
+}
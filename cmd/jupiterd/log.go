@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// A logWriter writes to a file which can be reopened after being
+// rotated, or to the standard error if it has no name.
+type logWriter struct {
+	mu   sync.Mutex
+	name string
+	f    *os.File
+}
+
+func openLog(name string) (*logWriter, error) {
+	w := &logWriter{name: name, f: os.Stderr}
+	if name == "" {
+		return w, nil
+	}
+	return w, w.Reopen()
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Write(p)
+}
+
+// Reopen closes the log file and opens it again
+func (w *logWriter) Reopen() error {
+	if w.name == "" {
+		return nil
+	}
+	f, err := os.OpenFile(w.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f != os.Stderr {
+		w.f.Close()
+	}
+	w.f = f
+	return nil
+}
+
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == os.Stderr {
+		return nil
+	}
+	return w.f.Close()
+}
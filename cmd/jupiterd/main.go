@@ -0,0 +1,195 @@
+// Jupiterd is the Jupiter daemon.  It serves a store with the TCP protocol,
+// and its stats and HTTP gateway if there is an http port in the
+// configuration.  Both use TLS if there is a certificate in the
+// configuration, and only allow the clients in it, if any.  The blocks
+// written are copied to the replicas in the configuration, if any.
+//
+// On SIGINT or SIGTERM, it stops accepting connections, waits for the
+// requests in progress and syncs the store before exiting.  On SIGHUP,
+// it reopens its log file, so that it can be rotated.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cespedes/jupiter"
+)
+
+var (
+	configFile = flag.String("c", "jupiter.conf", "configuration file")
+	logFile    = flag.String("log", "", "log file (default: standard error)")
+	logLevel   = flag.String("level", "info", "minimum level of the logged messages")
+	timeout    = flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for the requests in progress when exiting")
+
+	replicaInterval = flag.Duration("replica-interval", time.Second, "time between checks for new blocks to replicate")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-c config] [-log file] [-level level]\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "jupiterd: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	level, err := jupiter.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	out, err := openLog(*logFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	log := jupiter.NewTextLogger(out, level)
+
+	c, err := jupiter.ReadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if c.ListenPort == 0 {
+		return errors.New("no listen port in configuration")
+	}
+	c.Logger = log
+	j, err := jupiter.Open(c)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	var replicas []*jupiter.Replica
+	for _, addr := range c.Replicas {
+		r, err := jupiter.NewReplica(j, addr, jupiter.ReplicaCursorFile(c.DataLogFiles[0], addr))
+		if err != nil {
+			return err
+		}
+		if r.Options, err = c.ReplicaOptions(addr); err != nil {
+			return err
+		}
+		replicas = append(replicas, r)
+	}
+
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return err
+	}
+	auth := c.Auth()
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", c.ListenPort))
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	srv := jupiter.NewServer(j)
+	srv.Auth = auth
+	srv.Limits = c.Limits()
+	errc := make(chan error, 2)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+	var hsrv *http.Server
+	if c.HTTPPort != 0 {
+		// like NewHTTPHandler, but the gateway shares the limits
+		// of the server
+		stats := jupiter.NewStatsHandler(j)
+		stats.AddServer(srv)
+		for _, r := range replicas {
+			stats.AddReplica(r)
+		}
+		gw := jupiter.NewGateway(j)
+		gw.Server = srv
+		mux := http.NewServeMux()
+		mux.Handle("/stats", stats)
+		mux.Handle("/metrics", stats)
+		mux.Handle("/block", gw)
+		mux.Handle("/block/", gw)
+		mux.Handle("/object/", gw)
+		mux.Handle("/sync", gw)
+		var h http.Handler = mux
+		if auth != nil {
+			h = srv.HTTPHandler(mux)
+		}
+		hsrv = &http.Server{Addr: fmt.Sprintf(":%d", c.HTTPPort), Handler: h, TLSConfig: tlsConfig}
+		go func() {
+			if tlsConfig != nil {
+				errc <- hsrv.ListenAndServeTLS("", "")
+			} else {
+				errc <- hsrv.ListenAndServe()
+			}
+		}()
+	}
+	rctx, stopReplicas := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func(r *jupiter.Replica) {
+			defer wg.Done()
+			r.Run(rctx, *replicaInterval)
+		}(r)
+	}
+	log.Log(jupiter.LevelInfo, "jupiterd started", jupiter.Field{Key: "listen", Value: c.ListenPort}, jupiter.Field{Key: "http", Value: c.HTTPPort}, jupiter.Field{Key: "tls", Value: tlsConfig != nil}, jupiter.Field{Key: "auth", Value: auth != nil}, jupiter.Field{Key: "limits", Value: srv.Limits != nil})
+	if err := notify("READY=1"); err != nil {
+		log.Log(jupiter.LevelWarn, "sd_notify failed", jupiter.Field{Key: "error", Value: err})
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case err = <-errc:
+			log.Log(jupiter.LevelError, "server failed", jupiter.Field{Key: "error", Value: err})
+		case sig := <-sigc:
+			if sig == syscall.SIGHUP {
+				if err := out.Reopen(); err != nil {
+					log.Log(jupiter.LevelError, "cannot reopen log", jupiter.Field{Key: "error", Value: err})
+				} else {
+					log.Log(jupiter.LevelInfo, "log reopened")
+				}
+				continue
+			}
+			log.Log(jupiter.LevelInfo, "shutting down", jupiter.Field{Key: "signal", Value: sig})
+		}
+		break
+	}
+	notify("STOPPING=1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if hsrv != nil {
+		if e := hsrv.Shutdown(ctx); e != nil {
+			log.Log(jupiter.LevelWarn, "http shutdown", jupiter.Field{Key: "error", Value: e})
+		}
+	}
+	if e := srv.Shutdown(ctx); e != nil {
+		log.Log(jupiter.LevelWarn, "server shutdown", jupiter.Field{Key: "error", Value: e})
+	}
+	stopReplicas()
+	wg.Wait()
+	for _, r := range replicas {
+		r.Close()
+	}
+	if e := j.Sync(); e != nil {
+		return e
+	}
+	log.Log(jupiter.LevelInfo, "jupiterd stopped")
+	return err
+}
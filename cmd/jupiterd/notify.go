@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// notify sends a message to systemd, if jupiterd was started by it
+// with Type=notify.  See sd_notify(3).
+func notify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract socket
+	}
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Write([]byte(state))
+	return err
+}
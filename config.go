@@ -1,13 +1,268 @@
 package jupiter
 
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
 type Config struct {
 	ListenPort   int
 	HTTPPort     int
 	BinHeapFile  string
+	BucketSize   int
+	FPSize       int
 	IndexFiles   []string
 	DataLogFiles []string
+	// InitialBuckets is the number of buckets in a new index.  It must be a power of 2.
+	InitialBuckets int
+	Hasher         Hasher   // for new data logs; nil means the one in the data log, or DefaultHasher
+	Replicas       []string // addresses of the secondaries for replication
+	// ReplicaConfigs has the options to connect to each secondary, if any
+	ReplicaConfigs map[string]*ReplicaConfig
+
+	TLSCert     string                // certificate of the servers, to use TLS
+	TLSKey      string                // key of the certificate
+	TLSClientCA string                // CA of the client certificates, if they are accepted
+	Tokens      map[string]string     // identity of each pre-shared token
+	Permissions map[string]Permission // of each identity; see Auth
+	Quotas      map[string]uint64     // bytes of new blocks of each identity; see Limits
+	RateLimits  map[string]float64    // requests per second of each identity
+
+	Logger Logger // not read from the configuration file
+}
+
+// A ReplicaConfig has the options to connect to a secondary
+type ReplicaConfig struct {
+	Token   string // pre-shared token to authenticate with
+	TLS     bool   // connect with TLS
+	TLSCA   string // CA of the certificate of the secondary; "" means the ones of the system
+	TLSCert string // client certificate and key, if any
+	TLSKey  string
+}
+
+// replicaConfig returns the options of a secondary, creating them
+func (c *Config) replicaConfig(addr string) *ReplicaConfig {
+	if c.ReplicaConfigs == nil {
+		c.ReplicaConfigs = make(map[string]*ReplicaConfig)
+	}
+	if c.ReplicaConfigs[addr] == nil {
+		c.ReplicaConfigs[addr] = new(ReplicaConfig)
+	}
+	return c.ReplicaConfigs[addr]
+}
+
+// ReadConfig reads a configuration file.
+// It is a text file, with one line for each configuration option.
+// Empty lines and lines starting with '#' are ignored.
+// Relative file names are relative to the directory of the configuration file.
+func ReadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &Config{
+		BucketSize:     BlockSize,
+		FPSize:         ScoreBytesInEntry,
+		InitialBuckets: 1,
+	}
+	dir := filepath.Dir(filename)
+	path := func(s string) string {
+		if filepath.IsAbs(s) {
+			return s
+		}
+		return filepath.Join(dir, s)
+	}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		key, n := fields[0], 1
+		if m, ok := optionFields[key]; ok {
+			n = m
+		}
+		if len(fields) != n+1 {
+			return nil, fmt.Errorf("%s:%d: syntax error", filename, line)
+		}
+		value := fields[1]
+		switch key {
+		case "listen":
+			c.ListenPort, err = parsePort(value)
+		case "http":
+			c.HTTPPort, err = parsePort(value)
+		case "heap":
+			c.BinHeapFile = path(value)
+		case "bucketsize":
+			c.BucketSize, err = strconv.Atoi(value)
+		case "fpsize":
+			c.FPSize, err = strconv.Atoi(value)
+		case "buckets":
+			c.IndexFiles = append(c.IndexFiles, path(value))
+		case "data":
+			c.DataLogFiles = append(c.DataLogFiles, path(value))
+		case "initialbuckets":
+			c.InitialBuckets, err = strconv.Atoi(value)
+		case "hash":
+			c.Hasher, err = HasherByName(value)
+		case "replica":
+			c.Replicas = append(c.Replicas, value)
+		case "replicatoken":
+			c.replicaConfig(value).Token = fields[2]
+		case "replicatls":
+			rc := c.replicaConfig(value)
+			rc.TLS = true
+			if fields[2] != "system" {
+				rc.TLSCA = path(fields[2])
+			}
+		case "replicacert":
+			rc := c.replicaConfig(value)
+			rc.TLS, rc.TLSCert, rc.TLSKey = true, path(fields[2]), path(fields[3])
+		case "tlscert":
+			c.TLSCert = path(value)
+		case "tlskey":
+			c.TLSKey = path(value)
+		case "tlsclientca":
+			c.TLSClientCA = path(value)
+		case "token":
+			if c.Tokens == nil {
+				c.Tokens = make(map[string]string)
+			}
+			c.Tokens[value] = fields[2]
+		case "allow":
+			if c.Permissions == nil {
+				c.Permissions = make(map[string]Permission)
+			}
+			c.Permissions[value], err = ParsePermission(fields[2])
+		case "quota":
+			if c.Quotas == nil {
+				c.Quotas = make(map[string]uint64)
+			}
+			c.Quotas[value], err = parseSize(fields[2])
+		case "ratelimit":
+			if c.RateLimits == nil {
+				c.RateLimits = make(map[string]float64)
+			}
+			c.RateLimits[value], err = parseRate(fields[2])
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// optionFields has the number of values of the configuration options
+// which do not have just one
+var optionFields = map[string]int{
+	"token":     2, // token identity
+	"allow":     2, // identity permission
+	"quota":     2, // identity bytes
+	"ratelimit": 2, // identity requests-per-second
+
+	"replicatoken": 2, // address token
+	"replicatls":   2, // address ca-file
+	"replicacert":  3, // address cert-file key-file
+}
+
+// parseSize parses a number of bytes, optionally followed by
+// K, M, G or T (powers of 1024)
+func parseSize(s string) (uint64, error) {
+	digits, mult := s, uint64(1)
+	if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+		digits, mult = s[:len(s)-1], 1<<(10*uint(i+1))
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxUint64/mult {
+		return 0, fmt.Errorf("size %q too large", s)
+	}
+	return n * mult, nil
+}
+
+// parseRate parses a positive number of requests per second
+func parseRate(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !(r > 0) || math.IsInf(r, 0) {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return r, nil
+}
+
+// parsePort gets the port number from an address such as ":8080" or "8080"
+func parsePort(s string) (int, error) {
+	if strings.Contains(s, ":") {
+		_, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return 0, err
+		}
+		s = port
+	}
+	return strconv.Atoi(s)
+}
+
+// check verifies that a configuration can be used
+func (c *Config) check() error {
+	if c.BucketSize != BlockSize {
+		return fmt.Errorf("bucketsize must be %d", BlockSize)
+	}
+	if len(c.DataLogFiles) != 1 {
+		return fmt.Errorf("exactly one data log is supported")
+	}
+	if (c.BinHeapFile == "") != (len(c.IndexFiles) == 0) || len(c.IndexFiles) > 1 {
+		return fmt.Errorf("a heap and exactly one index file are needed to store the index")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tlscert and tlskey must be given together")
+	}
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		return fmt.Errorf("tlsclientca needs tlscert and tlskey")
+	}
+	for addr := range c.ReplicaConfigs {
+		found := false
+		for _, r := range c.Replicas {
+			found = found || r == addr
+		}
+		if !found {
+			return fmt.Errorf("options for %s, which is not a replica", addr)
+		}
+	}
+	return c.checkIndex()
 }
 
-func readConfig(f string) *Config {
+// checkIndex verifies the options of the index in a configuration
+func (c *Config) checkIndex() error {
+	if c.FPSize < 1 || c.FPSize > ScoreSize {
+		return fmt.Errorf("fpsize must be between 1 and %d", ScoreSize)
+	}
+	if c.InitialBuckets == 0 {
+		c.InitialBuckets = 1
+	}
+	if bits := log2(c.InitialBuckets); c.InitialBuckets < 0 || 1<<uint(bits) != c.InitialBuckets {
+		return fmt.Errorf("initialbuckets must be a power of 2")
+	} else if bits > maxInitialBits || bits > 8*c.FPSize {
+		return fmt.Errorf("initialbuckets must be at most 2^%d", minInt(maxInitialBits, 8*c.FPSize))
+	}
 	return nil
 }
@@ -2,14 +2,11 @@ package jupiter
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 )
 
-var ErrorNotFound = errors.New("Not Found")
-
 type ReadWriteSeekCloser interface {
 	io.ReadWriteSeeker
 	io.Closer
@@ -18,39 +15,210 @@ type ReadWriteSeekCloser interface {
 type DataLog struct {
 	filename string
 	fp       ReadWriteSeekCloser
+	hasher   Hasher
+	log      Logger
 }
 
-// Global header: version
+// Global header: a magic number ("Jlog"), a version and the hash algorithm
+// used for the scores, as big-endian 16-bit unsigned ints.
 
 // Each block is prefixed by a header that describes the contents of the
 // block.
 
-// The header contains the score and the uncompressed size.
+// The header contains the score, the type and the uncompressed size.
 
-// In the future, the header may also contain the type, a reference count,
+// In the future, the header may also contain a reference count,
 // the compression algorithm, the compressed size, and a checksum.
 
-func OpenDataLog(filename string) *DataLog {
-	panic("OpenDataLog() not implemented")
-	return nil
+const (
+	dataLogMagic      = "Jlog"
+	dataLogVersion    = 1
+	dataLogHeaderSize = 8
+	chunkHeaderSize   = ScoreSize + 3 // score, type, size
+	MaxChunkSize      = 0xFFFF - 1
+)
+
+// OpenDataLog opens a file used as DataLog, creating it if it does not exist.
+// New data logs use the Hasher h, or DefaultHasher if h is nil.
+// It is an error to open an existing data log with a different Hasher.
+func OpenDataLog(filename string, h Hasher) (*DataLog, error) {
+	return openDataLog(filename, h, os.O_RDWR|os.O_CREATE)
+}
+
+// OpenDataLogReadOnly is like OpenDataLog, but the file is opened read-only
+// and it must have a valid header.
+func OpenDataLogReadOnly(filename string, h Hasher) (*DataLog, error) {
+	return openDataLog(filename, h, os.O_RDONLY)
+}
+
+func openDataLog(filename string, h Hasher, flag int) (*DataLog, error) {
+	fp, err := os.OpenFile(filename, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	d := &DataLog{filename: filename, fp: fp, hasher: h, log: nopLogger{}}
+	if err := d.init(); err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("OpenDataLog(%s): %v", filename, err)
+	}
+	return d, nil
 }
 
-// NewDataLog creates a new DataLog without a physical back-up (data is stored in memory)
-func NewDataLog() *DataLog {
+// NewDataLog creates a new DataLog without a physical back-up (data is stored in memory).
+// It uses the Hasher h, or DefaultHasher if h is nil.
+func NewDataLog(h Hasher) *DataLog {
 	d := new(DataLog)
 	d.fp = newSeekableBuffer()
+	d.hasher = h
+	d.log = nopLogger{}
+	d.init()
 	return d
 }
 
+// Hasher returns the Hasher used for the scores in the data log
+func (d *DataLog) Hasher() Hasher {
+	return d.hasher
+}
+
+// init writes the global header in an empty data log, or checks it
+// if the data log is not empty.
+func (d *DataLog) init() error {
+	size, err := d.fp.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if d.hasher == nil {
+			d.hasher = DefaultHasher
+		}
+		header := make([]byte, dataLogHeaderSize)
+		copy(header, dataLogMagic)
+		binary.BigEndian.PutUint16(header[4:], dataLogVersion)
+		binary.BigEndian.PutUint16(header[6:], d.hasher.ID())
+		_, err = d.fp.Write(header)
+		return err
+	}
+	buf := make([]byte, dataLogHeaderSize)
+	if _, err := d.fp.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.fp, buf); err != nil {
+		return err
+	}
+	if string(buf[:4]) != dataLogMagic {
+		return fmt.Errorf("not a data log: %w", ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(buf[4:]); v != dataLogVersion {
+		return fmt.Errorf("unsupported data log version %d", v)
+	}
+	h, err := hasherByID(binary.BigEndian.Uint16(buf[6:]))
+	if err != nil {
+		return err
+	}
+	if d.hasher != nil && d.hasher.ID() != h.ID() {
+		return fmt.Errorf("data log uses %s, not %s", h.Name(), d.hasher.Name())
+	}
+	d.hasher = h
+	return nil
+}
+
+// Size returns the number of bytes in the data log, which is also
+// the address where the next block will be written.
+func (d *DataLog) Size() (uint64, error) {
+	size, err := d.fp.Seek(0, os.SEEK_END)
+	return uint64(size), err
+}
+
+// Sync commits the contents of the data log to stable storage
+func (d *DataLog) Sync() error {
+	if x, ok := d.fp.(interface{ Sync() error }); ok {
+		return x.Sync()
+	}
+	return nil
+}
+
+// Close closes the data log
+func (d *DataLog) Close() error {
+	return d.fp.Close()
+}
+
+// Walk calls fn for every block in the data log, starting at address "from"
+// (or at the first block, if from is 0).
+// If the last block in the data log is incomplete, Walk returns
+// io.ErrUnexpectedEOF.
+func (d *DataLog) Walk(from uint64, fn func(addr uint64, s Score, t Type, size int) error) error {
+	if from < dataLogHeaderSize {
+		from = dataLogHeaderSize
+	}
+	end, err := d.Size()
+	if err != nil {
+		return err
+	}
+	for addr := from; addr < end; {
+		if end-addr < chunkHeaderSize {
+			return io.ErrUnexpectedEOF
+		}
+		s, t, size, err := d.readHeader(addr)
+		if err != nil {
+			return err
+		}
+		next := addr + chunkHeaderSize + uint64(size)
+		if next > end {
+			return io.ErrUnexpectedEOF
+		}
+		if err := fn(addr, s, t, size); err != nil {
+			return err
+		}
+		addr = next
+	}
+	return nil
+}
+
+// Truncate discards everything in the data log after a given address
+func (d *DataLog) Truncate(addr uint64) error {
+	if x, ok := d.fp.(interface{ Truncate(size int64) (err error) }); ok {
+		return x.Truncate(int64(addr))
+	}
+	return fmt.Errorf("DataLog.Truncate(): %w", ErrNotImplemented)
+}
+
+// appendChunk adds the header and the contents of a block to buf
+func appendChunk(buf []byte, score Score, t Type, b []byte) ([]byte, error) {
+	if len(b) > MaxChunkSize {
+		return buf, fmt.Errorf("WriteChunk(): %d bytes: %w", len(b), ErrTooLarge)
+	}
+	buf = append(buf, score.s[:]...)
+	buf = append(buf, byte(t), byte(len(b)>>8), byte(len(b)))
+	return append(buf, b...), nil
+}
+
 // WriteChunk stores a block of data, compressing it, and returns its address in the data log.
 func (d *DataLog) WriteChunk(score Score, t Type, b []byte) (addr uint64, err error) {
-	fmt.Printf("DEBUG: DataLog.WriteChunk(score=%s, type=%d, b=%q)\n", score, t, b)
-	position, err := d.fp.Seek(0, os.SEEK_END)
+	addrs, err := d.WriteChunks([]Score{score}, []Type{t}, [][]byte{b})
 	if err != nil {
 		return 0, err
 	}
-	if len(b) >= 0xFFFF {
-		return 0, fmt.Errorf("WriteChunk(): tried to write more than 64K of data")
+	return addrs[0], nil
+}
+
+// WriteChunks stores several blocks of data with a single append to the data log,
+// and returns their addresses.
+func (d *DataLog) WriteChunks(scores []Score, types []Type, blocks [][]byte) (addrs []uint64, err error) {
+	if len(scores) != len(types) || len(scores) != len(blocks) {
+		return nil, fmt.Errorf("WriteChunks(): got %d scores, %d types and %d blocks", len(scores), len(types), len(blocks))
+	}
+	position, err := d.fp.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	addrs = make([]uint64, len(blocks))
+	for i := range blocks {
+		addrs[i] = uint64(position) + uint64(len(buf))
+		buf, err = appendChunk(buf, scores[i], types[i], blocks[i])
+		if err != nil {
+			return nil, err
+		}
 	}
 	defer func() {
 		if err != nil {
@@ -59,66 +227,67 @@ func (d *DataLog) WriteChunk(score Score, t Type, b []byte) (addr uint64, err er
 			}
 		}
 	}()
-	_, err = d.fp.Write(score.s[:])
+	_, err = d.fp.Write(buf)
 	if err != nil {
-		return 0, err
+		d.log.Log(LevelError, "data log write failed", Field{"addr", position}, Field{"error", err})
+		return nil, err
+	}
+	for i := range addrs {
+		d.log.Log(LevelDebug, "chunk written", Field{"score", scores[i]}, Field{"type", types[i]},
+			Field{"size", len(blocks[i])}, Field{"addr", addrs[i]})
 	}
-	l := make([]byte, 2)
-	binary.BigEndian.PutUint16(l, uint16(len(b)))
-	_, err = d.fp.Write(l)
+	return addrs, nil
+}
+
+// readHeader reads the header of the chunk stored at an address
+func (d *DataLog) readHeader(addr uint64) (s Score, t Type, size int, err error) {
+	_, err = d.fp.Seek(int64(addr), os.SEEK_SET)
 	if err != nil {
-		return 0, err
+		return s, 0, 0, err
 	}
-	_, err = d.fp.Write(b)
+	buf := make([]byte, chunkHeaderSize)
+	_, err = io.ReadFull(d.fp, buf)
 	if err != nil {
-		return 0, err
+		return s, 0, 0, err
 	}
-	return uint64(position), nil
+	copy(s.s[:], buf)
+	t = Type(buf[ScoreSize])
+	size = int(binary.BigEndian.Uint16(buf[ScoreSize+1:]))
+	return s, t, size, nil
 }
 
-// PeekChunk is used to check if a given block is stored at an address
+// PeekChunk is used to check if a given block is stored at an address, and returns its type
 func (d *DataLog) PeekChunk(score Score, addr uint64) (t Type, err error) {
-	var s Score
-	_, err = d.fp.Seek(int64(addr), os.SEEK_SET)
-	if err != nil {
-		return 0, err
-	}
-	_, err = io.ReadFull(d.fp, s.s[:])
+	s, t, _, err := d.readHeader(addr)
 	if err != nil {
 		return 0, err
 	}
 	if s.Equal(score) {
-		return 0, nil
+		return t, nil
 	}
-	return 0, ErrorNotFound
+	return 0, ErrNotFound
 }
 
 // GetChunk returns the block with a given score stored at an address
 func (d *DataLog) ReadChunk(score Score, addr uint64) (t Type, b []byte, err error) {
-	fmt.Printf("DEBUG: DataLog.ReadChunk(score=%s, addr=%d)\n", score, addr)
-	_, err = d.fp.Seek(int64(addr), os.SEEK_SET)
+	d.log.Log(LevelDebug, "chunk read", Field{"score", score}, Field{"addr", addr})
+	s, t, size, err := d.readHeader(addr)
 	if err != nil {
 		return 0, nil, err
 	}
-
-	buf := make([]byte, ScoreSize+2)
-	_, err = io.ReadFull(d.fp, buf)
-	if err != nil {
-		return 0, nil, err
-	}
-
-	var s Score
-	copy(s.s[:], buf)
 	if !s.Equal(score) {
-		return 0, nil, ErrorNotFound
+		return 0, nil, ErrNotFound
+	}
+	b = make([]byte, size)
+	_, err = io.ReadFull(d.fp, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, nil, &CorruptionError{Addr: addr, Score: score, Reason: "block is truncated"}
 	}
-	size := binary.BigEndian.Uint16(buf[ScoreSize:])
-	buf = make([]byte, size)
-	_, err = io.ReadFull(d.fp, buf)
 	if err != nil {
 		return 0, nil, err
 	}
-	return 0, buf, nil
+	if !d.hasher.Sum(b).Equal(score) {
+		return 0, nil, &CorruptionError{Addr: addr, Score: score, Reason: "contents do not match score"}
+	}
+	return t, b, nil
 }
-
-// func (j *Jupiter) Write(t Type, b []byte) (Score, error) {
@@ -0,0 +1,342 @@
+package jupiter
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// SealedRootType is the type of the blocks written by EncryptedStore.Seal
+const SealedRootType Type = 0x40
+
+const (
+	// UserKeySize is the size of the keys used to seal roots
+	UserKeySize = 32
+
+	encryptedEntrySize = 2*ScoreSize + 8 // locator, key and size
+	sealedRootSize     = 12 + 2*ScoreSize + 16
+
+	// maxLocators is the number of locators an EncryptedStore remembers
+	maxLocators = 1 << 20
+)
+
+// An EncryptedStore encrypts the blocks written to another Store, so that
+// the server does not see their contents.  It uses convergent encryption:
+// the key of a block is derived from its score, so the same data is always
+// stored as the same encrypted block, and it is deduplicated even when it
+// is written by different users.
+//
+// The scores returned by an EncryptedStore are the ones a Jupiter would
+// return (those of the plaintext), but the blocks are stored with the
+// score of their ciphertext (their locator).  The pointer blocks of
+// objects have the locators and keys of their children, so a whole tree
+// can be read from its root.  Seal stores the locator and key of a root
+// encrypted with the key of a user, and returns a sealed score that Open
+// turns back into the root with the same user key.
+//
+// The key of a block also depends on its type, so the inner store cannot
+// see that a block is written with another type: the EncryptedStore
+// returns ErrTypeMismatch only for the blocks whose type it remembers.
+//
+// An EncryptedStore remembers the locators of the last million blocks it
+// writes or reads, so other blocks can only be read by walking a tree from
+// an opened root, and a pointer block can only be written shortly after
+// its children.  ObjectWriter writes them in this order.
+// Scores are never sent to the inner store, only locators and sealed
+// scores.  The types and sizes of the blocks are not encrypted.
+//
+// With their locators, pointer blocks can have at most MaxFanout entries.
+// ObjectWriter respects it, so objects written with larger pointer blocks
+// have other scores than in a Jupiter.
+type EncryptedStore struct {
+	inner    Store
+	hasher   Hasher
+	aead     cipher.AEAD // seals roots
+	nonceKey []byte      // derives the nonce of a sealed root from its contents
+
+	mu      sync.Mutex
+	maxLocs int
+	lru     *list.List              // of *locEntry, most recently used first
+	locs    map[Score]*list.Element // locators of the blocks written or read
+}
+
+type locEntry struct {
+	score, loc Score
+	t          int // type of the block, or -1 if it has not been read
+}
+
+// NewEncryptedStore returns an EncryptedStore which stores its blocks in
+// inner, and seals its roots with a key of UserKeySize bytes.
+// Scores are computed with the Hasher of inner, if it has one.
+func NewEncryptedStore(inner Store, key []byte) (*EncryptedStore, error) {
+	if len(key) != UserKeySize {
+		return nil, fmt.Errorf("jupiter: NewEncryptedStore: key must have %d bytes, not %d", UserKeySize, len(key))
+	}
+	block, err := aes.NewCipher(subkey(key, "seal key"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	h := DefaultHasher
+	if x, ok := inner.(interface{ Hasher() Hasher }); ok {
+		h = x.Hasher()
+	}
+	return &EncryptedStore{
+		inner:    inner,
+		hasher:   h,
+		aead:     aead,
+		nonceKey: subkey(key, "seal nonce"),
+		maxLocs:  maxLocators,
+		lru:      list.New(),
+		locs:     make(map[Score]*list.Element),
+	}, nil
+}
+
+// Hasher returns the Hasher used to compute the scores
+func (e *EncryptedStore) Hasher() Hasher {
+	return e.hasher
+}
+
+// MaxFanout returns the largest number of entries in the pointer blocks
+// written to an EncryptedStore
+func (e *EncryptedStore) MaxFanout() int {
+	return MaxChunkSize / encryptedEntrySize
+}
+
+// subkey derives the key for one use from a user key
+func subkey(key []byte, use string) []byte {
+	k := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("jupiter "+use)), k)
+	return k
+}
+
+// crypt encrypts or decrypts the contents of a block of a given type with
+// the key derived from its score, its type and whether it has locators.
+// The same plaintext stored with another type gets another key (and a
+// pointer block with locators is not its plaintext), so a key is never
+// reused with other contents, and the IV can be constant; the score itself
+// checks that the contents are right.
+func crypt(score Score, t Type, b []byte) []byte {
+	locators := byte(0)
+	if pointerDepth(t) > 0 {
+		locators = 1
+	}
+	seed := append([]byte("jupiter convergent key\x00"), byte(t), locators)
+	key := sha256.Sum256(append(seed, score.s[:]...))
+	block, _ := aes.NewCipher(key[:])
+	out := make([]byte, len(b))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(out, b)
+	return out
+}
+
+func (e *EncryptedStore) locator(score Score) (Score, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	el, ok := e.locs[score]
+	if !ok {
+		return ZeroScore, false
+	}
+	e.lru.MoveToFront(el)
+	return el.Value.(*locEntry).loc, true
+}
+
+// blockType returns the type of a block written or read by this store
+func (e *EncryptedStore) blockType(score Score) (Type, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	el, ok := e.locs[score]
+	if !ok || el.Value.(*locEntry).t < 0 {
+		return 0, false
+	}
+	return Type(el.Value.(*locEntry).t), true
+}
+
+// remember adds the locator and type (-1 if it is not known) of a block,
+// forgetting the least recently used one if there are too many
+func (e *EncryptedStore) remember(score, loc Score, t int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if el, ok := e.locs[score]; ok {
+		le := el.Value.(*locEntry)
+		le.loc = loc
+		if t >= 0 {
+			le.t = t
+		}
+		e.lru.MoveToFront(el)
+		return
+	}
+	e.locs[score] = e.lru.PushFront(&locEntry{score: score, loc: loc, t: t})
+	for e.lru.Len() > e.maxLocs {
+		el := e.lru.Back()
+		e.lru.Remove(el)
+		delete(e.locs, el.Value.(*locEntry).score)
+	}
+}
+
+// Write encrypts and stores a block, and returns the score of its plaintext
+func (e *EncryptedStore) Write(t Type, b []byte) (Score, error) {
+	if t == SealedRootType {
+		return ZeroScore, fmt.Errorf("jupiter: EncryptedStore.Write(): type %d is reserved for sealed roots", t)
+	}
+	if len(b) > MaxChunkSize {
+		return ZeroScore, fmt.Errorf("jupiter: EncryptedStore.Write(): %d bytes: %w", len(b), ErrTooLarge)
+	}
+	score := e.hasher.Sum(b)
+	if tt, ok := e.blockType(score); ok && tt != t {
+		return ZeroScore, fmt.Errorf("jupiter: EncryptedStore.Write(): block already written with type %d: %w", tt, ErrTypeMismatch)
+	}
+	data := b
+	if pointerDepth(t) > 0 {
+		var err error
+		if data, err = e.addLocators(b); err != nil {
+			return ZeroScore, err
+		}
+	}
+	loc, err := e.inner.Write(t, crypt(score, t, data))
+	if err != nil {
+		return ZeroScore, err
+	}
+	e.remember(score, loc, int(t))
+	return score, nil
+}
+
+// addLocators adds the locator of every child to a pointer block
+func (e *EncryptedStore) addLocators(b []byte) ([]byte, error) {
+	entries, err := parsePointerBlock(b)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(entries)*encryptedEntrySize)
+	for _, entry := range entries {
+		loc, ok := e.locator(entry.score)
+		if !ok {
+			return nil, fmt.Errorf("jupiter: EncryptedStore.Write(): block %s in pointer block was not written or read by this store: %w", entry.score, ErrNotFound)
+		}
+		out = append(out, loc.s[:]...)
+		out = appendPointerEntry(out, entry)
+	}
+	if len(out) > MaxChunkSize {
+		return nil, fmt.Errorf("jupiter: EncryptedStore.Write(): pointer block with %d entries: %w", len(entries), ErrTooLarge)
+	}
+	return out, nil
+}
+
+// removeLocators remembers the locators in a pointer block read from the
+// inner store, and returns the pointer block without them
+func (e *EncryptedStore) removeLocators(b []byte) ([]byte, error) {
+	if len(b)%encryptedEntrySize != 0 {
+		return nil, fmt.Errorf("jupiter: invalid encrypted pointer block of %d bytes: %w", len(b), ErrCorrupt)
+	}
+	out := make([]byte, 0, len(b)/encryptedEntrySize*pointerEntrySize)
+	for i := 0; i < len(b); i += encryptedEntrySize {
+		var loc, score Score
+		copy(loc.s[:], b[i:])
+		copy(score.s[:], b[i+ScoreSize:])
+		e.remember(score, loc, -1)
+		out = append(out, b[i+ScoreSize:i+encryptedEntrySize]...)
+	}
+	return out, nil
+}
+
+// Read returns the type and plaintext of a block written or read by this
+// store, or of a root returned by Open.
+func (e *EncryptedStore) Read(score Score) (Type, []byte, error) {
+	key := score
+	loc, ok := e.locator(score)
+	if !ok {
+		return 0, nil, fmt.Errorf("jupiter: EncryptedStore.Read(%s): block was not written or read by this store: %w", score, ErrNotFound)
+	}
+	t, b, err := e.inner.Read(loc)
+	if err != nil {
+		return 0, nil, err
+	}
+	b = crypt(key, t, b)
+	if pointerDepth(t) > 0 {
+		if b, err = e.removeLocators(b); err != nil {
+			return 0, nil, err
+		}
+	}
+	if !e.hasher.Sum(b).Equal(key) {
+		return 0, nil, &CorruptionError{Score: key, Reason: fmt.Sprintf("block at locator %s does not match its key", loc)}
+	}
+	e.remember(key, loc, int(t))
+	return t, b, nil
+}
+
+// Seal stores the locator and key of a block written or read by this
+// store, encrypted with the user key, and returns the score to read it.
+// Sealing the same root with the same user key always gives the same score.
+func (e *EncryptedStore) Seal(root Score) (Score, error) {
+	loc, ok := e.locator(root)
+	if !ok {
+		return ZeroScore, fmt.Errorf("jupiter: EncryptedStore.Seal(%s): block was not written or read by this store: %w", root, ErrNotFound)
+	}
+	plain := append(append([]byte(nil), loc.s[:]...), root.s[:]...)
+	mac := hmac.New(sha256.New, e.nonceKey)
+	mac.Write(plain)
+	nonce := mac.Sum(nil)[:e.aead.NonceSize()]
+	sealed := e.aead.Seal(nonce, nonce, plain, []byte{byte(SealedRootType)})
+	return e.inner.Write(SealedRootType, sealed)
+}
+
+// Open returns the root sealed with Seal in a sealed score, which can
+// then be read.  It fails if the root was sealed with another user key.
+func (e *EncryptedStore) Open(sealed Score) (Score, error) {
+	loc, root, err := e.unseal(sealed)
+	if err != nil {
+		return ZeroScore, fmt.Errorf("jupiter: EncryptedStore.Open(%s): %w", sealed, err)
+	}
+	e.remember(root, loc, -1)
+	return root, nil
+}
+
+// unseal returns the locator and key stored in a sealed root
+func (e *EncryptedStore) unseal(score Score) (loc, key Score, err error) {
+	t, b, err := e.inner.Read(score)
+	if err != nil {
+		return loc, key, err
+	}
+	if t != SealedRootType || len(b) != sealedRootSize {
+		return loc, key, ErrNotFound
+	}
+	n := e.aead.NonceSize()
+	plain, err := e.aead.Open(nil, b[:n], b[n:], []byte{byte(SealedRootType)})
+	if err != nil {
+		return loc, key, errors.New("root sealed with another key")
+	}
+	copy(loc.s[:], plain)
+	copy(key.s[:], plain[ScoreSize:])
+	return loc, key, nil
+}
+
+// Has reports whether a block written or read by this store, or a root
+// returned by Open, is stored.  It is false for any other score.
+func (e *EncryptedStore) Has(score Score) bool {
+	loc, ok := e.locator(score)
+	return ok && e.inner.Has(loc)
+}
+
+// Sync syncs the inner store
+func (e *EncryptedStore) Sync() error {
+	return e.inner.Sync()
+}
+
+// Close closes the inner store, and forgets the locators of the blocks
+func (e *EncryptedStore) Close() error {
+	e.mu.Lock()
+	e.lru.Init()
+	e.locs = make(map[Score]*list.Element)
+	e.mu.Unlock()
+	return e.inner.Close()
+}
@@ -0,0 +1,171 @@
+package jupiter
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	m := NewMemStore(nil)
+	alice, err := NewEncryptedStore(m, bytes.Repeat([]byte{1}, UserKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptedStore(m, []byte("short")); err == nil {
+		t.Errorf("NewEncryptedStore() with a short key should fail")
+	}
+
+	data := bytes.Repeat([]byte("secret data, "), 20000)
+	w := NewObjectWriterSize(alice, 1024)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("ObjectWriter.Close(): %v", err)
+	}
+	if !w.Score().Equal(objectScore(t, data)) {
+		t.Errorf("EncryptedStore gives another score than a Jupiter")
+	}
+	sealed, err := alice.Seal(w.Score())
+	if err != nil {
+		t.Fatalf("Seal(): %v", err)
+	}
+	for score, b := range m.blocks {
+		if bytes.Contains(b.b, []byte("secret")) {
+			t.Fatalf("block %s is stored in plaintext", score)
+		}
+	}
+
+	// the sealed root can be opened with the same key in another session,
+	// and nothing can be read before
+	alice2, _ := NewEncryptedStore(m, bytes.Repeat([]byte{1}, UserKeySize))
+	if _, _, err := alice2.Read(w.Score()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of a root not opened: %v, want ErrNotFound", err)
+	}
+	if _, _, err := alice2.Read(sealed); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of a sealed score: %v, want ErrNotFound", err)
+	}
+	root, err := alice2.Open(sealed)
+	if err != nil || !root.Equal(w.Score()) {
+		t.Fatalf("Open() = %s, %v, want %s", root, err, w.Score())
+	}
+	if !alice2.Has(root) {
+		t.Errorf("Has() of an opened root is false")
+	}
+	r, err := NewObjectReader(alice2, root)
+	if err != nil {
+		t.Fatalf("NewObjectReader(): %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ObjectReader: %d bytes, %v", len(got), err)
+	}
+
+	// but not with another key
+	bob, _ := NewEncryptedStore(m, bytes.Repeat([]byte{2}, UserKeySize))
+	if _, err := bob.Open(sealed); err == nil {
+		t.Errorf("Open() of a root sealed with another key should fail")
+	}
+
+	// the same data written by another user is deduplicated:
+	// only the sealed root is new
+	n := m.Len()
+	w = NewObjectWriterSize(bob, 1024)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Seal(w.Score()); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != n+1 {
+		t.Errorf("writing the same object again added %d blocks, want 1", m.Len()-n)
+	}
+}
+
+func TestEncryptedFanout(t *testing.T) {
+	e, err := NewEncryptedStore(NewMemStore(nil), make([]byte, UserKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewObjectWriterSize(e, MaxChunkSize)
+	if w.fanout != e.MaxFanout() {
+		t.Errorf("ObjectWriter has a fanout of %d, want %d", w.fanout, e.MaxFanout())
+	}
+	if e.MaxFanout()*encryptedEntrySize > MaxChunkSize {
+		t.Errorf("MaxFanout() = %d: pointer blocks of %d bytes", e.MaxFanout(), e.MaxFanout()*encryptedEntrySize)
+	}
+
+	// an object with a full pointer block, made of small data blocks
+	w = NewObjectWriterSize(e, 100)
+	w.fanout = e.MaxFanout()
+	if _, err := w.Write(make([]byte, 100*(e.MaxFanout()+1))); err != nil {
+		t.Fatalf("ObjectWriter.Write(): %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ObjectWriter.Close(): %v", err)
+	}
+}
+
+func TestEncryptedTypes(t *testing.T) {
+	m := NewMemStore(nil)
+	e, err := NewEncryptedStore(m, make([]byte, UserKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same data with another type is encrypted with another key, so
+	// only the store which remembers the first type can detect it
+	if _, err := e.Write(1, []byte("same data")); err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if _, err := e.Write(2, []byte("same data")); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Write() with another type: %v, want ErrTypeMismatch", err)
+	}
+	e2, _ := NewEncryptedStore(m, make([]byte, UserKeySize))
+	if _, err := e2.Write(2, []byte("same data")); err != nil {
+		t.Fatalf("Write() with another type in another session: %v", err)
+	}
+	b := make([]byte, pointerEntrySize)
+	if bytes.Equal(crypt(GetScore(b), 0, b), crypt(GetScore(b), ObjectPointerType, b)) {
+		t.Errorf("a data block and a pointer block have the same key")
+	}
+}
+
+func TestEncryptedLocators(t *testing.T) {
+	e, err := NewEncryptedStore(NewMemStore(nil), make([]byte, UserKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.maxLocs = 10
+	var scores []Score
+	for i := 0; i < 20; i++ {
+		s, err := e.Write(1, []byte{byte(i)})
+		if err != nil {
+			t.Fatalf("Write(%d): %v", i, err)
+		}
+		scores = append(scores, s)
+	}
+	if len(e.locs) != 10 || e.lru.Len() != 10 {
+		t.Errorf("%d locators remembered, want 10", len(e.locs))
+	}
+	if _, _, err := e.Read(scores[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of a forgotten block: %v, want ErrNotFound", err)
+	}
+	if _, b, err := e.Read(scores[19]); err != nil || b[0] != 19 {
+		t.Errorf("Read() of a recent block: %v, %v", b, err)
+	}
+}
+
+// objectScore returns the score of an object written to a Jupiter
+func objectScore(t *testing.T, data []byte) Score {
+	j, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewObjectWriterSize(j, 1024)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return w.Score()
+}
@@ -0,0 +1,42 @@
+package jupiter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Jupiter.  They can be wrapped with more context,
+// so they should be checked with errors.Is.
+var (
+	ErrNotFound       = errors.New("jupiter: block not found")
+	ErrCorrupt        = errors.New("jupiter: corrupt data")
+	ErrTooLarge       = errors.New("jupiter: block too large")
+	ErrTypeMismatch   = errors.New("jupiter: block already stored with a different type")
+	ErrIndexFull      = errors.New("jupiter: index full")
+	ErrNotImplemented = errors.New("jupiter: not implemented")
+	ErrAmbiguous      = errors.New("jupiter: ambiguous score prefix")
+	ErrPermission     = errors.New("jupiter: permission denied")
+	ErrQuotaExceeded  = errors.New("jupiter: quota exceeded")
+	ErrRateLimited    = errors.New("jupiter: too many requests")
+)
+
+// ErrorNotFound is the old name of ErrNotFound.
+//
+// Deprecated: use ErrNotFound.
+var ErrorNotFound = ErrNotFound
+
+// A CorruptionError is returned when the block stored at an address of the
+// data log is not valid.  errors.Is(err, ErrCorrupt) is true for it.
+type CorruptionError struct {
+	Addr   uint64 // address of the block in the data log
+	Score  Score  // score of the block that was expected
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("jupiter: corrupt block %s at address %d: %s", e.Score, e.Addr, e.Reason)
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupt
+}
@@ -0,0 +1,88 @@
+package jupiter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if _, _, err := j.Read(GetScore([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read(missing): %v, want ErrNotFound", err)
+	}
+	if _, err := j.ReadBatch([]Score{GetScore([]byte("missing"))}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadBatch(missing): %v, want ErrNotFound", err)
+	}
+	if _, err := j.Write(1, []byte("hello")); err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if _, err := j.Write(2, []byte("hello")); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Write() with another type: %v, want ErrTypeMismatch", err)
+	}
+	if _, err := j.WriteBatch([]Block{{2, []byte("hello")}}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("WriteBatch() with another type: %v, want ErrTypeMismatch", err)
+	}
+	if _, err := j.Write(1, make([]byte, MaxChunkSize+1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Write() of a big block: %v, want ErrTooLarge", err)
+	}
+	if _, err := NewObjectReader(j, GetScore([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("NewObjectReader(missing): %v, want ErrNotFound", err)
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	s, err := j.Write(1, []byte("hello, world"))
+	if err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+
+	// change the last byte of the block
+	b := j.datalog.fp.(*seekableBuffer).Bytes()
+	b[len(b)-1] = 'D'
+
+	_, _, err = j.Read(s)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Read(): %v, want ErrCorrupt", err)
+	}
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Read(): %v, want a *CorruptionError", err)
+	}
+	if cerr.Addr != 8 || !cerr.Score.Equal(s) {
+		t.Errorf("CorruptionError = %+v", cerr)
+	}
+}
+
+func TestNoPanics(t *testing.T) {
+	var b Bucket
+	b.Init(ScoreBytesInEntry, 1, []byte{0x80})
+	if _, err := b.Add(ZeroScore, 8); err == nil {
+		t.Errorf("Bucket.Add() of a score outside of the bucket should fail")
+	}
+	b[0] = 'X'
+	if err := b.Check(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Bucket.Check() with bad magic: %v, want ErrCorrupt", err)
+	}
+	b.Init(1, 8, []byte{0})
+	b[bktNumEntries+1] = 1
+	if err := b.Check(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Bucket.Check() with empty entries: %v, want ErrCorrupt", err)
+	}
+	var bh BinHeap
+	if _, _, err := bh.GetBucket(ZeroScore); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("GetBucket() on an empty heap: %v, want ErrCorrupt", err)
+	}
+	if _, err := newSeekableBuffer().Seek(0, 42); err == nil {
+		t.Errorf("seekableBuffer.Seek() with invalid whence should fail")
+	}
+	if _, err := parsePointerBlock(make([]byte, 3)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("parsePointerBlock(): %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,244 @@
+package jupiter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// An export stream has a header with a magic number ("Jexp"), a version
+// and the ID of the Hasher used for the scores, followed by a record for
+// each block:
+//
+//	'B' type(1) score(32) length(2) data
+//
+// and a final record with the number of blocks and the SHA-256 of
+// everything before it:
+//
+//	'E' count(8) checksum(32)
+//
+// All the integers are big-endian.  Blocks are exported after the blocks
+// they point to, so that an interrupted import never leaves a tree with
+// missing blocks.
+const (
+	exportMagic      = "Jexp"
+	exportVersion    = 1
+	exportHeaderSize = 4 + 2 + 2
+
+	exportBlock = 'B'
+	exportEnd   = 'E'
+)
+
+// A BlockWriter stores blocks.  Every Store is a BlockWriter.
+type BlockWriter interface {
+	Write(t Type, b []byte) (Score, error)
+	Has(score Score) bool
+}
+
+// An Exporter writes blocks read from a store into an export stream.
+// Each block is written only once.
+type Exporter struct {
+	r      BlockReader
+	w      *bufio.Writer
+	sum    hash.Hash
+	seen   map[Score]bool
+	blocks uint64
+	err    error
+}
+
+// NewExporter writes the header of an export stream and returns an
+// Exporter for the blocks in r.  If r has a Hasher method, its Hasher
+// is recorded in the header; otherwise, DefaultHasher is.
+func NewExporter(w io.Writer, r BlockReader) (*Exporter, error) {
+	h := DefaultHasher
+	if x, ok := r.(interface{ Hasher() Hasher }); ok {
+		h = x.Hasher()
+	}
+	e := &Exporter{r: r, w: bufio.NewWriter(w), sum: sha256.New(), seen: make(map[Score]bool)}
+	var header [exportHeaderSize]byte
+	copy(header[:], exportMagic)
+	binary.BigEndian.PutUint16(header[4:], exportVersion)
+	binary.BigEndian.PutUint16(header[6:], h.ID())
+	return e, e.write(header[:])
+}
+
+// write sends some bytes to the stream, and adds them to the checksum
+func (e *Exporter) write(b []byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.sum.Write(b)
+	_, e.err = e.w.Write(b)
+	return e.err
+}
+
+// WriteBlock exports a block read from the store.  If it is a pointer
+// block of an object, the blocks it points to are exported first.
+func (e *Exporter) WriteBlock(score Score) error {
+	if e.seen[score] {
+		return nil
+	}
+	t, b, err := e.r.Read(score)
+	if err != nil {
+		return fmt.Errorf("jupiter: export %s: %w", score, err)
+	}
+	if pointerDepth(t) > 0 {
+		entries, err := parsePointerBlock(b)
+		if err != nil {
+			return fmt.Errorf("jupiter: export %s: %w", score, err)
+		}
+		for _, p := range entries {
+			if err := e.WriteBlock(p.score); err != nil {
+				return err
+			}
+		}
+	}
+	e.seen[score] = true
+	e.blocks++
+	header := make([]byte, 0, 1+1+ScoreSize+2)
+	header = append(header, exportBlock, byte(t))
+	header = append(header, score.s[:]...)
+	header = append(header, byte(len(b)>>8), byte(len(b)))
+	if err := e.write(header); err != nil {
+		return err
+	}
+	return e.write(b)
+}
+
+// Blocks returns the number of blocks exported
+func (e *Exporter) Blocks() uint64 {
+	return e.blocks
+}
+
+// Close writes the end of the stream.  It does not close the underlying writer.
+func (e *Exporter) Close() error {
+	var end [1 + 8]byte
+	end[0] = exportEnd
+	binary.BigEndian.PutUint64(end[1:], e.blocks)
+	if err := e.write(end[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.sum.Sum(nil)); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// Export writes an export stream with the blocks in the trees with the given roots
+func Export(w io.Writer, r BlockReader, roots ...Score) error {
+	e, err := NewExporter(w, r)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := e.WriteBlock(root); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// ImportStats has the number of blocks read from an export stream,
+// and how many of them were already stored.
+type ImportStats struct {
+	Blocks  uint64
+	Skipped uint64
+	Bytes   uint64 // size of the blocks written
+}
+
+func (s ImportStats) String() string {
+	return fmt.Sprintf("%d blocks, %d already stored, %d bytes written", s.Blocks, s.Skipped, s.Bytes)
+}
+
+// Import reads an export stream and stores its blocks in w.  The score of
+// every block is verified, and blocks already in w are skipped.
+// A stream that is truncated or does not match its checksum returns an
+// error wrapping ErrCorrupt, but the blocks read before are kept.
+func Import(r io.Reader, w BlockWriter) (ImportStats, error) {
+	var stats ImportStats
+	br := bufio.NewReader(r)
+	sum := sha256.New()
+	read := func(b []byte) error {
+		if _, err := io.ReadFull(br, b); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("jupiter: import: truncated stream: %w", ErrCorrupt)
+			}
+			return err
+		}
+		sum.Write(b)
+		return nil
+	}
+
+	var header [exportHeaderSize]byte
+	if err := read(header[:]); err != nil {
+		return stats, err
+	}
+	if string(header[:4]) != exportMagic {
+		return stats, fmt.Errorf("jupiter: import: not an export stream: %w", ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(header[4:]); v != exportVersion {
+		return stats, fmt.Errorf("jupiter: import: unsupported version %d", v)
+	}
+	h, err := hasherByID(binary.BigEndian.Uint16(header[6:]))
+	if err != nil {
+		return stats, fmt.Errorf("jupiter: import: %w", err)
+	}
+
+	var rec [1 + 1 + ScoreSize + 2]byte
+	for {
+		if err := read(rec[:1]); err != nil {
+			return stats, err
+		}
+		if rec[0] == exportEnd {
+			break
+		}
+		if rec[0] != exportBlock {
+			return stats, fmt.Errorf("jupiter: import: unknown record %q: %w", rec[0], ErrCorrupt)
+		}
+		if err := read(rec[1:]); err != nil {
+			return stats, err
+		}
+		t := Type(rec[1])
+		score, _ := ScoreFromBytes(rec[2 : 2+ScoreSize])
+		b := make([]byte, binary.BigEndian.Uint16(rec[2+ScoreSize:]))
+		if err := read(b); err != nil {
+			return stats, err
+		}
+		if !h.Sum(b).Equal(score) {
+			return stats, fmt.Errorf("jupiter: import: %s: contents do not match score: %w", score, ErrCorrupt)
+		}
+		stats.Blocks++
+		if w.Has(score) {
+			stats.Skipped++
+			continue
+		}
+		s, err := w.Write(t, b)
+		if err != nil {
+			return stats, fmt.Errorf("jupiter: import: %s: %w", score, err)
+		}
+		if !s.Equal(score) {
+			return stats, fmt.Errorf("jupiter: import: %s: stored with score %s (the stores use different hashes)", score, s)
+		}
+		stats.Bytes += uint64(len(b))
+	}
+
+	var count [8]byte
+	if err := read(count[:]); err != nil {
+		return stats, err
+	}
+	want := sum.Sum(nil)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(br, got); err != nil {
+		return stats, fmt.Errorf("jupiter: import: truncated stream: %w", ErrCorrupt)
+	}
+	if string(got) != string(want) {
+		return stats, fmt.Errorf("jupiter: import: checksum mismatch: %w", ErrCorrupt)
+	}
+	if n := binary.BigEndian.Uint64(count[:]); n != stats.Blocks {
+		return stats, fmt.Errorf("jupiter: import: %d blocks, expected %d: %w", stats.Blocks, n, ErrCorrupt)
+	}
+	return stats, nil
+}
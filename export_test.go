@@ -0,0 +1,59 @@
+package jupiter
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src, _ := New()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 100000)
+	w := NewObjectWriterSize(src, 1024)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := src.Write(5, []byte("another block"))
+
+	var buf bytes.Buffer
+	if err := Export(&buf, src, w.Score(), other, w.Score()); err != nil {
+		t.Fatalf("Export(): %v", err)
+	}
+	dst, _ := New()
+	dst.Write(5, []byte("another block"))
+	stats, err := Import(bytes.NewReader(buf.Bytes()), dst)
+	if err != nil || stats.Blocks == 0 || stats.Skipped != 1 {
+		t.Fatalf("Import() = %v, %v", stats, err)
+	}
+	r, err := NewObjectReader(dst, w.Score())
+	if err != nil {
+		t.Fatalf("NewObjectReader(): %v", err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("imported object: %d bytes, %v", len(got), err)
+	}
+
+	// importing again stores nothing
+	if s, err := Import(bytes.NewReader(buf.Bytes()), dst); err != nil || s.Skipped != stats.Blocks {
+		t.Errorf("second Import() = %v, %v", s, err)
+	}
+
+	// damaged streams are detected
+	b := buf.Bytes()
+	bad := append([]byte(nil), b...)
+	bad[100] ^= 1
+	if _, err := Import(bytes.NewReader(bad), dst); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Import() of a damaged stream: %v, want ErrCorrupt", err)
+	}
+	if _, err := Import(bytes.NewReader(b[:len(b)-10]), dst); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Import() of a truncated stream: %v, want ErrCorrupt", err)
+	}
+
+	// the scores must be computed with the same hash
+	sha, _ := NewHasher(SHA256)
+	if _, err := Import(bytes.NewReader(b), sha); err == nil {
+		t.Errorf("Import() into a store with another hash should fail")
+	}
+}
@@ -0,0 +1,55 @@
+package jupiter
+
+import (
+	"fmt"
+	"os"
+)
+
+// Format creates the files of a new Jupiter: the data log with its header
+// and, if they are in the configuration, an index with
+// c.InitialBuckets empty buckets and a BinHeap pointing to them.
+// None of the files may exist.
+func Format(c *Config) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	files := append([]string{c.BinHeapFile}, c.IndexFiles...)
+	files = append(files, c.DataLogFiles...)
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("Format(): %s already exists", f)
+		}
+	}
+
+	d, err := OpenDataLog(c.DataLogFiles[0], c.Hasher)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if e := d.Close(); err == nil {
+		err = e
+	}
+	if err != nil || c.BinHeapFile == "" {
+		return err
+	}
+
+	in, err := CreateIndex(c.IndexFiles[0], c.FPSize)
+	if err != nil {
+		return err
+	}
+	bh, err := presplit(in, log2(c.InitialBuckets))
+	if err == nil {
+		err = in.Sync()
+	}
+	if e := in.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	bh.filename = c.BinHeapFile
+	return bh.Sync()
+}
@@ -0,0 +1,98 @@
+package jupiter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("heap heap\nbuckets index\ndata data.log\ninitialbuckets 16\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	if _, err := Open(c); err == nil {
+		t.Fatalf("Open() of an unformatted store should fail")
+	}
+	if err := Format(c); err != nil {
+		t.Fatalf("Format(): %v", err)
+	}
+	if err := Format(c); err == nil {
+		t.Fatalf("Format() of an existing store should fail")
+	}
+	if fi, err := os.Stat(c.IndexFiles[0]); err != nil || fi.Size() != 16*BlockSize {
+		t.Fatalf("index file: %v, %v", fi, err)
+	}
+
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	if j.index.NumBuckets() != 16 || j.binheap.Depth() != 4 {
+		t.Errorf("new store has %d buckets and depth %d", j.index.NumBuckets(), j.binheap.Depth())
+	}
+	write := func(j *Jupiter, from, to int) {
+		for i := from; i < to; i++ {
+			if _, err := j.Write(2, []byte(fmt.Sprintf("block %d", i))); err != nil {
+				t.Fatalf("Write(%d): %v", i, err)
+			}
+		}
+	}
+	check := func(j *Jupiter, n int) {
+		for i := 0; i < n; i++ {
+			b := []byte(fmt.Sprintf("block %d", i))
+			if !j.Has(GetScore(b)) {
+				t.Fatalf("block %d not found", i)
+			}
+		}
+		if m := j.Metrics(); m.Blocks != uint64(n) {
+			t.Errorf("store has %d blocks, want %d", m.Blocks, n)
+		}
+	}
+	write(j, 0, 10000)
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+
+	// the index is read from disk
+	j, err = Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	if j.index.NumBuckets() <= 16 {
+		t.Errorf("index was not read from disk: %d buckets", j.index.NumBuckets())
+	}
+	check(j, 10000)
+
+	// blocks written after the last Sync are added when opening
+	write(j, 10000, 12000)
+	j.datalog.Sync()
+	j2, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	check(j2, 12000)
+	j2.Close()
+	j.index.Close()
+	j.datalog.Close()
+
+	// a bucket not in the heap means that the index must be rebuilt
+	f, _ := os.OpenFile(c.IndexFiles[0], os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(newBucket(ScoreBytesInEntry, 0, nil)[:])
+	f.Close()
+	j, err = Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	check(j, 12000)
+	j.Close()
+}
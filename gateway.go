@@ -0,0 +1,226 @@
+package jupiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Gateway gives access to the blocks of a Jupiter over HTTP:
+//
+//	GET /block/{score}     returns the contents of a block
+//	HEAD /block/{score}    checks if a block is stored
+//	PUT /block?type=N      stores a block, and returns its score
+//	POST /sync             commits the blocks written to stable storage
+//	GET /object/{score}    returns the contents of an object (Range requests are supported)
+//
+// Blocks never change, so the responses have the score as ETag
+// and can be cached forever.
+//
+// A request is given up when its client goes away, or when the time in
+// milliseconds of its X-Jupiter-Timeout header expires; in that case, the
+// response is 504 Gateway Timeout.
+//
+// If Server is set, each request counts for the rate limit of its identity
+// in that Server (see Server.HTTPHandler), and the blocks written count for
+// its quota, as if they were written to the Server.
+type Gateway struct {
+	j      *Jupiter
+	Server *Server
+}
+
+// NewGateway returns a Gateway for a Jupiter
+func NewGateway(j *Jupiter) *Gateway {
+	return &Gateway{j: j}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.Server != nil {
+		if err := g.Server.allow(requestIdentity(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+	switch {
+	case r.URL.Path == "/block" && r.Method == "PUT":
+		g.putBlock(w, r)
+	case strings.HasPrefix(r.URL.Path, "/block/") && (r.Method == "GET" || r.Method == "HEAD"):
+		g.getBlock(w, r, strings.TrimPrefix(r.URL.Path, "/block/"))
+	case strings.HasPrefix(r.URL.Path, "/object/") && (r.Method == "GET" || r.Method == "HEAD"):
+		g.getObject(w, r, strings.TrimPrefix(r.URL.Path, "/object/"))
+	case r.URL.Path == "/sync" && r.Method == "POST":
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		if err := g.j.SyncContext(ctx); err != nil {
+			http.Error(w, err.Error(), errorCode(err, http.StatusInternalServerError))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/block" || strings.HasPrefix(r.URL.Path, "/block/") || strings.HasPrefix(r.URL.Path, "/object/") || r.URL.Path == "/sync":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// requestContext returns the context of a request, with the timeout
+// sent by the client, if any
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ms, err := strconv.ParseUint(r.Header.Get("X-Jupiter-Timeout"), 10, 32)
+	if err != nil {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), time.Duration(ms)*time.Millisecond)
+}
+
+// errorCode returns the status code for an error: 504 if the request
+// timed out, 507 if a quota was exceeded, or else the given one
+func errorCode(err error, code int) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	}
+	return code
+}
+
+// A contextReader reads blocks from a Jupiter with a context
+type contextReader struct {
+	ctx context.Context
+	j   *Jupiter
+}
+
+func (r contextReader) Read(score Score) (Type, []byte, error) {
+	return r.j.ReadContext(r.ctx, score)
+}
+
+// setImmutable sets the headers of a response for a block or object
+// which will never change
+func setImmutable(w http.ResponseWriter, score Score) {
+	w.Header().Set("ETag", `"`+score.String()+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+}
+
+// notModified reports whether the client already has a given block or object
+func notModified(r *http.Request, score Score) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == `"`+score.String()+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Gateway) getBlock(w http.ResponseWriter, r *http.Request, s string) {
+	score, err := ParseScore(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !g.j.Has(score) {
+		http.NotFound(w, r)
+		return
+	}
+	setImmutable(w, score)
+	if notModified(r, score) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	t, b, err := g.j.ReadContext(ctx, score)
+	if err != nil {
+		http.Error(w, err.Error(), errorCode(err, http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set("X-Jupiter-Type", strconv.Itoa(int(t)))
+	if r.Method == "GET" {
+		w.Write(b)
+	}
+}
+
+func (g *Gateway) putBlock(w http.ResponseWriter, r *http.Request) {
+	t, err := strconv.ParseUint(r.URL.Query().Get("type"), 10, 8)
+	if err != nil {
+		http.Error(w, "invalid type", http.StatusBadRequest)
+		return
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxChunkSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(b) > MaxChunkSize {
+		http.Error(w, "block too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	var score Score
+	if g.Server != nil {
+		score, err = g.Server.write(ctx, requestIdentity(r), Type(t), b)
+	} else {
+		score, err = g.j.WriteContext(ctx, Type(t), b)
+	}
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, ErrTypeMismatch) {
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), errorCode(err, code))
+		return
+	}
+	w.Header().Set("ETag", `"`+score.String()+`"`)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, score)
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, s string) {
+	score, err := ParseScore(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !g.j.Has(score) {
+		http.NotFound(w, r)
+		return
+	}
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	or, err := NewObjectReader(contextReader{ctx, g.j}, score)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	setImmutable(w, score)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// ServeContent handles Range, If-Range and If-None-Match
+	http.ServeContent(w, r, "", time.Time{}, or)
+}
+
+// NewHTTPHandler returns a handler with the stats and the Gateway of
+// a Jupiter.  The StatsHandler is returned too, so that caches can be
+// added to it.
+func NewHTTPHandler(j *Jupiter) (*http.ServeMux, *StatsHandler) {
+	mux := http.NewServeMux()
+	stats := NewStatsHandler(j)
+	mux.Handle("/stats", stats)
+	mux.Handle("/metrics", stats)
+	gw := NewGateway(j)
+	mux.Handle("/block", gw)
+	mux.Handle("/block/", gw)
+	mux.Handle("/object/", gw)
+	mux.Handle("/sync", gw)
+	return mux, stats
+}
@@ -0,0 +1,102 @@
+package jupiter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGateway(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	g := NewGateway(j)
+	do := func(method, url string, body []byte, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, bytes.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("PUT", "/block?type=3", []byte("hello"))
+	score := GetScore([]byte("hello")).String()
+	if w.Code != http.StatusCreated || strings.TrimSpace(w.Body.String()) != score {
+		t.Fatalf("PUT /block: %d %q", w.Code, w.Body.String())
+	}
+	w = do("GET", "/block/"+score, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || w.Header().Get("X-Jupiter-Type") != "3" {
+		t.Errorf("GET /block: %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != `"`+score+`"` || !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("GET /block: headers %v", w.Header())
+	}
+	w = do("GET", "/block/"+score, nil, "If-None-Match", `"`+score+`"`)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("GET /block with If-None-Match: %d", w.Code)
+	}
+	w = do("HEAD", "/block/"+ZeroScore.String(), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("HEAD /block of a missing block: %d", w.Code)
+	}
+	w = do("GET", "/block/xyz", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET /block with invalid score: %d", w.Code)
+	}
+	w = do("PUT", "/block?type=4", []byte("hello"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("PUT /block with different type: %d", w.Code)
+	}
+
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(3)).Read(data)
+	ow := NewObjectWriter(j)
+	ow.Write(data)
+	ow.Close()
+	w = do("GET", "/object/"+ow.Score().String(), nil, "Range", "bytes=1000-1999")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data[1000:2000]) {
+		t.Errorf("GET /object with Range: %d (%d bytes)", w.Code, w.Body.Len())
+	}
+	w = do("GET", "/object/"+ow.Score().String(), nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("GET /object: %d (%d bytes)", w.Code, w.Body.Len())
+	}
+}
+
+func TestGatewayWriteError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("heap heap\nbuckets index\ndata data.log\ninitialbuckets 4\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	if err := Format(c); err != nil {
+		t.Fatalf("Format(): %v", err)
+	}
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	j.Close()
+
+	// a failed write is not a conflict
+	w := httptest.NewRecorder()
+	NewGateway(j).ServeHTTP(w, httptest.NewRequest("PUT", "/block?type=3", strings.NewReader("hello")))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("PUT /block to a closed store: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -2,4 +2,4 @@ module github.com/cespedes/jupiter
 
 go 1.13
 
-require github.com/dsoprea/go-logging v0.0.0-20200710184922-b02d349568dd
+require golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
@@ -0,0 +1,152 @@
+package jupiter
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A Hasher computes the scores of blocks.  Each store uses a single
+// Hasher, chosen when it is created and recorded in its data log header.
+// Digests shorter than ScoreSize are padded with zeros.
+type Hasher interface {
+	ID() uint16   // identifies the algorithm in the data log header
+	Name() string // such as "sha512-256"
+	Size() int    // length of the digest, in bytes
+	Sum(b []byte) Score
+}
+
+type hashFunc struct {
+	id   uint16
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+func (h *hashFunc) ID() uint16     { return h.id }
+func (h *hashFunc) Name() string   { return h.name }
+func (h *hashFunc) Size() int      { return h.size }
+func (h *hashFunc) String() string { return h.name }
+
+func (h *hashFunc) Sum(b []byte) Score {
+	var s Score
+	hh := h.new()
+	hh.Write(b)
+	copy(s.s[:], hh.Sum(nil))
+	return s
+}
+
+func newBlake2b256() hash.Hash {
+	h, _ := blake2b.New256(nil) // only fails with a key longer than 64 bytes
+	return h
+}
+
+// Available hashers.  SHA512_256 is the default; SHA1 is only meant for
+// interoperability with Venti.
+var (
+	SHA512_256 Hasher = &hashFunc{1, "sha512-256", 32, sha512.New512_256}
+	SHA256     Hasher = &hashFunc{2, "sha256", 32, sha256.New}
+	BLAKE2b256 Hasher = &hashFunc{3, "blake2b-256", 32, newBlake2b256}
+	SHA1       Hasher = &hashFunc{4, "sha1", 20, sha1.New}
+)
+
+var hashers = []Hasher{SHA512_256, SHA256, BLAKE2b256, SHA1}
+
+// DefaultHasher is the Hasher used by new stores if none is given
+var DefaultHasher = SHA512_256
+
+// HasherByName returns the Hasher with a given name
+func HasherByName(name string) (Hasher, error) {
+	for _, h := range hashers {
+		if h.Name() == name {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q", name)
+}
+
+// hasherByID returns the Hasher with the ID stored in a data log header
+func hasherByID(id uint16) (Hasher, error) {
+	for _, h := range hashers {
+		if h.ID() == id {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %d: %w", id, ErrCorrupt)
+}
+
+// TagScore returns a score prefixed with the name of its algorithm, such as
+// "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709".  Only the bytes of the
+// digest are written.
+func TagScore(h Hasher, s Score) string {
+	return h.Name() + ":" + hex.EncodeToString(s.s[:h.Size()])
+}
+
+// ParseTaggedScore reads a score written by TagScore
+func ParseTaggedScore(s string) (Hasher, Score, error) {
+	var score Score
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, score, fmt.Errorf("ParseTaggedScore(%q): missing algorithm", s)
+	}
+	h, err := HasherByName(s[:i])
+	if err != nil {
+		return nil, score, fmt.Errorf("ParseTaggedScore(%q): %v", s, err)
+	}
+	digest := s[i+1:]
+	if len(digest) != 2*h.Size() {
+		return nil, score, fmt.Errorf("ParseTaggedScore(%q): length is %d (should be %d)", s, len(digest), 2*h.Size())
+	}
+	if _, err := hex.Decode(score.s[:], []byte(digest)); err != nil {
+		return nil, ZeroScore, fmt.Errorf("ParseTaggedScore(%q): %v", s, err)
+	}
+	return h, score, nil
+}
+
+// parallelHashSize is the amount of data from which sumBlocks hashes
+// blocks in parallel
+const parallelHashSize = 256 * 1024
+
+// sumBlocks returns the scores of several blocks.  Large batches are
+// split among several goroutines.  A single block cannot be hashed in
+// parallel without changing its score, so Write hashes each block before
+// locking the store instead, and concurrent writes are hashed in parallel.
+func sumBlocks(h Hasher, blocks [][]byte) []Score {
+	scores := make([]Score, len(blocks))
+	total := 0
+	for _, b := range blocks {
+		total += len(b)
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if total < parallelHashSize || workers < 2 || len(blocks) < 2 {
+		for i, b := range blocks {
+			scores[i] = h.Sum(b)
+		}
+		return scores
+	}
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				scores[i] = h.Sum(blocks[i])
+			}
+		}()
+	}
+	for i := range blocks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return scores
+}
@@ -0,0 +1,133 @@
+package jupiter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	// digests of ""
+	want := map[string]string{
+		"sha512-256":  "sha512-256:c672b8d1ef56ed28ab87c3622c5114069bdd3ad7b8f9737498d0c01ecef0967a",
+		"sha256":      "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"blake2b-256": "blake2b-256:0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8",
+		"sha1":        "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709",
+	}
+	for name, tagged := range want {
+		h, err := HasherByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := h.Sum(nil)
+		if got := TagScore(h, s); got != tagged {
+			t.Errorf("TagScore(%s) = %s, want %s", name, got, tagged)
+		}
+		h2, s2, err := ParseTaggedScore(tagged)
+		if err != nil || h2 != h || !s2.Equal(s) {
+			t.Errorf("ParseTaggedScore(%s) = %v, %s, %v", tagged, h2, s2, err)
+		}
+		if s3, err := ParseScore(tagged); err != nil || !s3.Equal(s) {
+			t.Errorf("ParseScore(%s) = %s, %v", tagged, s3, err)
+		}
+	}
+	if _, err := HasherByName("md5"); err == nil {
+		t.Errorf("HasherByName(md5) should fail")
+	}
+	if _, _, err := ParseTaggedScore("sha1:da39"); err == nil {
+		t.Errorf("ParseTaggedScore(sha1:da39) should fail")
+	}
+}
+
+func TestSumBlocks(t *testing.T) {
+	var blocks [][]byte
+	for i := 0; i < 100; i++ {
+		blocks = append(blocks, make([]byte, 8192))
+		blocks[i][0] = byte(i)
+	}
+	for i, s := range sumBlocks(BLAKE2b256, blocks) {
+		if !s.Equal(BLAKE2b256.Sum(blocks[i])) {
+			t.Errorf("sumBlocks(): block %d has score %s", i, s)
+		}
+	}
+}
+
+func TestOpenHasher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Config{BucketSize: BlockSize, FPSize: ScoreBytesInEntry, DataLogFiles: []string{filepath.Join(dir, "data.log")}, Hasher: SHA1}
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	var scores []Score
+	for i := 0; i < 100; i++ {
+		s, err := j.Write(1, []byte(fmt.Sprintf("block %d", i)))
+		if err != nil {
+			t.Fatalf("Write(): %v", err)
+		}
+		if !s.Equal(SHA1.Sum([]byte(fmt.Sprintf("block %d", i)))) {
+			t.Fatalf("Write(): score is %s", s)
+		}
+		scores = append(scores, s)
+	}
+	j.Close()
+
+	c.Hasher = SHA256
+	if _, err := Open(c); err == nil {
+		t.Fatalf("Open() with another hasher should fail")
+	}
+	c.Hasher = nil
+	j, err = Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	defer j.Close()
+	if j.Hasher() != SHA1 {
+		t.Errorf("Hasher() = %v, want sha1", j.Hasher())
+	}
+	for i, s := range scores {
+		if _, b, err := j.Read(s); err != nil || string(b) != fmt.Sprintf("block %d", i) {
+			t.Errorf("Read(%s) = %q, %v", s, b, err)
+		}
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	j, err := NewHasher(SHA1)
+	if err != nil {
+		t.Fatalf("NewHasher(): %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		b := []byte(fmt.Sprintf("block %d", i))
+		s, err := j.Write(1, b)
+		if err != nil {
+			t.Fatalf("Write(): %v", err)
+		}
+		if !s.Equal(SHA1.Sum(b)) {
+			t.Fatalf("Write(): score is %s", s)
+		}
+		if _, b2, err := j.Read(s); err != nil || string(b2) != string(b) {
+			t.Errorf("Read(%s) = %q, %v", s, b2, err)
+		}
+	}
+	if j.Hasher() != SHA1 {
+		t.Errorf("Hasher() = %v, want sha1", j.Hasher())
+	}
+
+	// the Hasher is recorded in the header of the data log
+	data := j.datalog.fp.(*seekableBuffer).Bytes()
+	d := &DataLog{fp: newSeekableBufferWithBytes(data), hasher: SHA256}
+	if err := d.init(); err == nil {
+		t.Errorf("init() with another hasher should fail")
+	}
+	d = &DataLog{fp: newSeekableBufferWithBytes(data)}
+	if err := d.init(); err != nil || d.Hasher() != SHA1 {
+		t.Errorf("init() = %v, Hasher() = %v, want sha1", err, d.Hasher())
+	}
+}
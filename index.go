@@ -1,26 +1,110 @@
 package jupiter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"sort"
 )
 
 // An Index has several buckets of the same size (8192 bytes)
 // Each bucket has a header and several entries of the same size (but possibly different among different buckets)
+// If the Index is stored in disk, bucket n is at offset n*BlockSize in its file.
 type Index struct {
 	filename          string
+	fp                *os.File
 	scoreBytesInEntry int
 	// A "firstBucket" could be used to support several indexes
 	// TODO firstBucket       uint32
 	numBuckets uint32
 	maxBuckets uint32 // 0 if there is no limit
 	buckets    map[uint32]*Bucket
+	dirty      map[uint32]bool     // buckets not yet written to disk
+	fill       [numFillBins]uint64 // number of buckets with 0-10%, 10-20%... of entries used
+	bins       []int8              // bin of each bucket in fill, or -1
 }
 
-// OpenIndex opens a file used as Index, and reads its contents into memory
-func OpenIndex(filename string) *Index {
-	panic("OpenIndex() not implemented")
-	return &Index{filename: filename}
+// OpenIndex opens a file used as Index, and reads its first numBuckets buckets into memory.
+// It returns an error wrapping ErrCorrupt if any of them is not valid, or if
+// there are more buckets in the file.
+func OpenIndex(filename string, scoreBytesInEntry int, numBuckets uint32) (*Index, error) {
+	fp, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	in := NewIndex(scoreBytesInEntry)
+	in.filename = filename
+	in.fp = fp
+	r := bufio.NewReaderSize(fp, 16*BlockSize)
+	for n := uint32(0); ; n++ {
+		b := new(Bucket)
+		if _, err := io.ReadFull(r, b[:]); err == io.EOF {
+			if n < numBuckets {
+				err = fmt.Errorf("only %d buckets: %w", n, ErrCorrupt)
+			} else {
+				break
+			}
+		} else if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("bucket %d is truncated: %w", n, ErrCorrupt)
+		} else if err == nil && n < numBuckets {
+			err = b.Check()
+		} else if err == nil && b.Check() == nil {
+			err = fmt.Errorf("unexpected bucket %d: %w", n, ErrCorrupt)
+		}
+		if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("OpenIndex(%s): %w", filename, err)
+		}
+		if n < numBuckets {
+			in.buckets[n] = b
+			in.updateFill(n)
+		}
+	}
+	in.numBuckets = numBuckets
+	return in, nil
+}
+
+// OpenIndexReadOnly is like OpenIndex, but the file is opened read-only and
+// the buckets are not checked: the invalid ones are kept, to be inspected
+// with RawBucket, and the missing or truncated ones are left out.
+func OpenIndexReadOnly(filename string, scoreBytesInEntry int, numBuckets uint32) (*Index, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	in := NewIndex(scoreBytesInEntry)
+	in.filename = filename
+	in.fp = fp
+	r := bufio.NewReaderSize(fp, 16*BlockSize)
+	for n := uint32(0); n < numBuckets; n++ {
+		b := new(Bucket)
+		if _, err := io.ReadFull(r, b[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("OpenIndexReadOnly(%s): %w", filename, err)
+		}
+		in.buckets[n] = b
+		if b.Check() == nil {
+			in.updateFill(n)
+		}
+	}
+	in.numBuckets = numBuckets
+	return in, nil
+}
+
+// CreateIndex creates an empty Index stored in a file.  If the file exists, it is truncated.
+func CreateIndex(filename string, scoreBytesInEntry int) (*Index, error) {
+	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	in := NewIndex(scoreBytesInEntry)
+	in.filename = filename
+	in.fp = fp
+	return in, nil
 }
 
 // NexIndex creates a new index from scratch
@@ -28,7 +112,7 @@ func OpenIndex(filename string) *Index {
 //	return &Index{scoreBytesInEntry: scoreBytesInEntry, firstBucket: firstBucket}
 //}
 func NewIndex(scoreBytesInEntry int) *Index {
-	return &Index{scoreBytesInEntry: scoreBytesInEntry, buckets: make(map[uint32]*Bucket)}
+	return &Index{scoreBytesInEntry: scoreBytesInEntry, buckets: make(map[uint32]*Bucket), dirty: make(map[uint32]bool)}
 }
 
 // NumBuckets returns the number of buckets in an Index
@@ -42,33 +126,104 @@ func (in *Index) MaxBuckets() uint32 {
 }
 
 // Bucket returns a Bucket given its position
-func (in *Index) Bucket(n uint32) *Bucket {
+func (in *Index) Bucket(n uint32) (*Bucket, error) {
 	b := in.buckets[n]
-	if b != nil {
-		return b
+	if b == nil {
+		return nil, fmt.Errorf("Index.Bucket(%d): no such bucket: %w", n, ErrCorrupt)
+	}
+	if err := b.Check(); err != nil {
+		return nil, fmt.Errorf("Index.Bucket(%d): %w", n, err)
+	}
+	return b, nil
+}
+
+// markDirty records that a bucket has changed and must be written to disk
+func (in *Index) markDirty(n uint32) {
+	in.updateFill(n)
+	if in.fp != nil {
+		in.dirty[n] = true
+	}
+}
+
+// updateFill moves a bucket to its current bin in the histogram of fill
+func (in *Index) updateFill(n uint32) {
+	for uint32(len(in.bins)) <= n {
+		in.bins = append(in.bins, -1)
+	}
+	if old := in.bins[n]; old >= 0 {
+		in.fill[old]--
+	}
+	bin := -1
+	if b := in.buckets[n]; b != nil && b.Check() == nil {
+		bin = fillBin(b)
+	}
+	in.bins[n] = int8(bin)
+	if bin >= 0 {
+		in.fill[bin]++
 	}
-	panic("Index.Bucket(): read from file: not implemented")
-	return nil
+}
+
+// Fill returns the number of buckets with 0-10%, 10-20%... of entries used
+func (in *Index) Fill() []uint64 {
+	return append([]uint64(nil), in.fill[:]...)
 }
 
 // Sync writes the dirty buckets into disk
 func (in *Index) Sync() error {
-	panic("Index.Sync(): not implemented")
-	return nil
+	return in.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but it stops when the context is done.
+// The buckets not yet written are still dirty.
+func (in *Index) SyncContext(ctx context.Context) error {
+	if in.fp == nil {
+		return nil
+	}
+	list := make([]uint32, 0, len(in.dirty))
+	for n := range in.dirty {
+		list = append(list, n)
+	}
+	// New buckets are written first: if there is a crash before the
+	// BinHeap is written, OpenIndex will find them and the index will be
+	// rebuilt, instead of using a split bucket without its new half.
+	sort.Slice(list, func(i, j int) bool { return list[i] > list[j] })
+	for _, n := range list {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("Index.Sync(): %w", err)
+		}
+		if _, err := in.fp.WriteAt(in.buckets[n][:], int64(n)*BlockSize); err != nil {
+			return fmt.Errorf("Index.Sync(): %w", err)
+		}
+		delete(in.dirty, n)
+	}
+	return in.fp.Sync()
 }
 
-// Write writes the whole index into disk
-func (in *Index) Write(f io.Writer, numBlocks uint64) error {
-	panic("Index.Write(): not implemented")
+// Close closes the file of an Index, without syncing it
+func (in *Index) Close() error {
+	if in.fp == nil {
+		return nil
+	}
+	return in.fp.Close()
+}
+
+// Write writes the whole index
+func (in *Index) Write(w io.Writer) error {
+	for n := uint32(0); n < in.numBuckets; n++ {
+		if _, err := w.Write(in.buckets[n][:]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // NewBucket adds a new bucket to the Index.
 func (in *Index) NewBucket(numScoreCommonBits int, scoreCommonBytes []byte) (uint32, error) {
 	if in.maxBuckets > 0 && in.numBuckets+1 >= in.maxBuckets {
-		return 0, fmt.Errorf("Not enough size in index for a new bucket")
+		return 0, fmt.Errorf("Index.NewBucket(): %w", ErrIndexFull)
 	}
 	in.buckets[in.numBuckets] = newBucket(in.scoreBytesInEntry, numScoreCommonBits, scoreCommonBytes)
+	in.markDirty(in.numBuckets)
 	in.numBuckets++
 	return in.numBuckets - 1, nil
 }
@@ -0,0 +1,172 @@
+package jupiter
+
+import (
+	"fmt"
+)
+
+// Inspect calls fn with the BinHeap, the Index and the DataLog of a Jupiter,
+// while it is locked.  It is meant for debugging tools: fn must not modify them.
+func (j *Jupiter) Inspect(fn func(bh *BinHeap, in *Index, d *DataLog) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return fn(j.binheap, j.index, j.datalog)
+}
+
+// Leaves calls fn for every leaf in a BinHeap, from left to right, with its
+// position in the table, the bits common to all the scores in the leaf
+// (as a string of '0' and '1') and its bucket number.
+func (bh *BinHeap) Leaves(fn func(k int, prefix string, bucket uint32) error) error {
+	var walk func(k int, prefix string) error
+	walk = func(k int, prefix string) error {
+		if k >= len(bh.table) {
+			return fmt.Errorf("BinHeap.Leaves: entry %d (prefix %s) has no leaves: %w", k, prefix, ErrCorrupt)
+		}
+		if bh.table[k] != BHNotLeaf {
+			return fn(k, prefix, bh.table[k])
+		}
+		if err := walk(2*k+1, prefix+"0"); err != nil {
+			return err
+		}
+		return walk(2*k+2, prefix+"1")
+	}
+	return walk(0, "")
+}
+
+// Path returns the entries of a BinHeap from the root to the leaf for a score
+func (bh *BinHeap) Path(s Score) []int {
+	var path []int
+	for k, b := 0, 0; k < len(bh.table); b++ {
+		path = append(path, k)
+		if bh.table[k] != BHNotLeaf || b == ScoreSize*8 {
+			break
+		}
+		if !isBitSet(s.s[:], b) {
+			k = k*2 + 1
+		} else {
+			k = k*2 + 2
+		}
+	}
+	return path
+}
+
+// A BucketHeader has the fields in the header of a Bucket
+type BucketHeader struct {
+	NumEntries         int
+	NumAddressBytes    int
+	NumScoreBytes      int
+	NumScoreCommonBits int
+	CommonScore        Score
+}
+
+// Header returns the decoded header of a Bucket
+func (b *Bucket) Header() BucketHeader {
+	common, mask := b.CommonScore()
+	return BucketHeader{
+		NumEntries:         b.NumEntries(),
+		NumAddressBytes:    b.numAddressBytes(),
+		NumScoreBytes:      b.numScoreBytes(),
+		NumScoreCommonBits: mask,
+		CommonScore:        common,
+	}
+}
+
+// RawBucket returns a Bucket given its position, without checking that it
+// is valid, or nil if there is no such bucket.
+func (in *Index) RawBucket(n uint32) *Bucket {
+	return in.buckets[n]
+}
+
+// A RawEntry has the contents of an entry of a Bucket, as stored in it
+type RawEntry struct {
+	Score []byte // the part of the score after the common bytes
+	Addr  uint64
+}
+
+// RawEntries decodes the entries of a Bucket as its header says, even if
+// it is not valid.  Only the entries which fit in the Bucket are returned.
+func (b *Bucket) RawEntries() []RawEntry {
+	scoreBytes := b.numScoreBytes() - b.numScoreCommonBits()/8
+	if scoreBytes < 0 {
+		scoreBytes = 0
+	}
+	size := scoreBytes + b.numAddressBytes()
+	if size == 0 {
+		return nil
+	}
+	n := b.NumEntries()
+	if max := (BlockSize - b.entryOffset()) / size; n > max {
+		n = max
+	}
+	result := make([]RawEntry, n)
+	for i := range result {
+		offset := b.entryOffset() + i*size
+		result[i].Score = b[offset : offset+scoreBytes]
+		for _, c := range b[offset+scoreBytes : offset+size] {
+			result[i].Addr = result[i].Addr<<8 | uint64(c)
+		}
+	}
+	return result
+}
+
+// Score returns the part of the score stored in an entry,
+// and the number of bits in it
+func (e *Entry) Score() (Score, int) {
+	return e.score, e.mask
+}
+
+// Addr returns the address in the data log stored in an entry
+func (e *Entry) Addr() uint64 {
+	return e.addr
+}
+
+// A Candidate is an address in the data log where a block may be stored
+type Candidate struct {
+	Addr  uint64
+	Score Score // score of the block stored at Addr
+	Err   error // nil if the block is at Addr
+}
+
+// A Trace describes how a score is looked up in the index
+type Trace struct {
+	Score      Score
+	Path       []int  // entries of the BinHeap from the root to the leaf
+	Bucket     uint32 // bucket in the leaf
+	Candidates []Candidate
+}
+
+// Found reports whether the block was found in any of the candidates
+func (t *Trace) Found() bool {
+	for _, c := range t.Candidates {
+		if c.Err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup looks up a score as Read does, and returns every step:
+// the path in the BinHeap, the bucket and the result of reading each
+// of the addresses found in it.
+func (j *Jupiter) Lookup(score Score) (*Trace, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	t := &Trace{Score: score, Path: j.binheap.Path(score)}
+	_, buckn, err := j.binheap.GetBucket(score)
+	if err != nil {
+		return t, err
+	}
+	t.Bucket = buckn
+	bucket, err := j.index.Bucket(buckn)
+	if err != nil {
+		return t, err
+	}
+	for _, addr := range bucket.GetAddress(score) {
+		c := Candidate{Addr: addr}
+		c.Score, _, _, c.Err = j.datalog.readHeader(addr)
+		if c.Err == nil {
+			_, _, c.Err = j.datalog.ReadChunk(score, addr)
+		}
+		t.Candidates = append(t.Candidates, c)
+	}
+	return t, nil
+}
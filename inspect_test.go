@@ -0,0 +1,113 @@
+package jupiter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	j, err := NewConfig(&Config{FPSize: ScoreBytesInEntry, InitialBuckets: 4})
+	if err != nil {
+		t.Fatalf("NewConfig(): %v", err)
+	}
+	var scores []Score
+	for i := 0; i < 100; i++ {
+		s, _ := j.Write(1, []byte(fmt.Sprintf("block %d", i)))
+		scores = append(scores, s)
+	}
+	var prefixes []string
+	entries := 0
+	err = j.Inspect(func(bh *BinHeap, in *Index, d *DataLog) error {
+		return bh.Leaves(func(k int, prefix string, n uint32) error {
+			prefixes = append(prefixes, prefix)
+			b, err := in.Bucket(n)
+			if err != nil {
+				return err
+			}
+			h := b.Header()
+			if h.NumScoreCommonBits != 2 || h.NumScoreBytes != ScoreBytesInEntry {
+				t.Errorf("bucket %d: header %+v", n, h)
+			}
+			entries += h.NumEntries
+			return nil
+		})
+	})
+	if err != nil || fmt.Sprint(prefixes) != "[00 01 10 11]" || entries != 100 {
+		t.Errorf("Leaves(): %v, %d entries, %v", prefixes, entries, err)
+	}
+
+	tr, err := j.Lookup(scores[0])
+	if err != nil || len(tr.Path) != 3 || !tr.Found() {
+		t.Errorf("Lookup() = %+v, %v", tr, err)
+	}
+	tr, err = j.Lookup(GetScore([]byte("missing")))
+	if err != nil || tr.Found() {
+		t.Errorf("Lookup(missing) = %+v, %v", tr, err)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("heap heap\nbuckets index\ndata data.log\ninitialbuckets 4\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	if err := Format(c); err != nil {
+		t.Fatalf("Format(): %v", err)
+	}
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		j.Write(1, []byte(fmt.Sprintf("block %d", i)))
+	}
+	j.Close()
+
+	// a corrupt bucket and an incomplete block at the end of the data log
+	// would make Open reset the index and truncate the data log
+	f, _ := os.OpenFile(c.IndexFiles[0], os.O_WRONLY, 0)
+	f.WriteAt([]byte("Xbkt"), 0)
+	f.Close()
+	f, _ = os.OpenFile(c.DataLogFiles[0], os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("garbage"))
+	f.Close()
+	files := []string{c.BinHeapFile, c.IndexFiles[0], c.DataLogFiles[0]}
+	var before [][]byte
+	for _, file := range files {
+		b, _ := ioutil.ReadFile(file)
+		before = append(before, b)
+	}
+
+	j, err = OpenReadOnly(c)
+	if err != nil {
+		t.Fatalf("OpenReadOnly(): %v", err)
+	}
+	if b := j.index.RawBucket(0); b == nil {
+		t.Errorf("RawBucket(0) = nil")
+	} else if b.Check() == nil || b.NumEntries() == 0 || len(b.RawEntries()) != b.NumEntries() {
+		t.Errorf("RawBucket(0): %d entries, %d decoded, %v", b.NumEntries(), len(b.RawEntries()), b.Check())
+	}
+	if _, err := j.Write(1, []byte("new block")); !errors.Is(err, ErrPermission) {
+		t.Errorf("Write(): %v, want ErrPermission", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Errorf("Close(): %v", err)
+	}
+	for i, file := range files {
+		if b, _ := ioutil.ReadFile(file); !bytes.Equal(b, before[i]) {
+			t.Errorf("%s was modified", file)
+		}
+	}
+}
@@ -1,82 +1,802 @@
 package jupiter
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 const ScoreBytesInEntry = 10
 
+// maxInitialBits is the maximum number of bits in the score used to
+// choose among the initial buckets of an index
+const maxInitialBits = 24
+
+// A Jupiter is a block store.  It is safe for concurrent use.
 type Jupiter struct {
+	mu      sync.Mutex
+	stats   stats
+	log     Logger
 	config  *Config
 	binheap *BinHeap
 	// indexes  []*Index   // Just one index and one datalog for now
 	// datalogs []*DataLog
 	index   *Index
 	datalog *DataLog
+
+	readOnly bool // opened with OpenReadOnly
 }
 
+// errReadOnly is returned when writing to a Jupiter opened with OpenReadOnly
+var errReadOnly = fmt.Errorf("jupiter: store opened read-only: %w", ErrPermission)
+
 type Type byte
 
-func Open(c *Config) *Jupiter {
+// Open opens a Jupiter stored in disk.
+// If the configuration has a BinHeap and an index file, they are read
+// from disk and only the blocks written after the last Sync are added to
+// the index.  Otherwise, the index is rebuilt in memory from the data log.
+func Open(c *Config) (*Jupiter, error) {
+	return OpenContext(context.Background(), c)
+}
+
+// OpenContext is like Open, but it gives up adding blocks to the index
+// when the context is done.  Nothing is written to the BinHeap until the
+// next Sync, so the work left is done by the next Open.
+func OpenContext(ctx context.Context, c *Config) (*Jupiter, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	var j *Jupiter
+	var err error
+	if c.BinHeapFile != "" {
+		j, err = openIndex(c)
+		if err != nil && j != nil && j.index != nil {
+			j.index.Close()
+		}
+	} else {
+		j, err = newJupiter(c.FPSize, log2(c.InitialBuckets))
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.config = c
+	if c.Logger != nil {
+		j.log = c.Logger
+	}
+	j.datalog, err = OpenDataLog(c.DataLogFiles[0], c.Hasher)
+	if err != nil {
+		j.index.Close()
+		return nil, err
+	}
+	j.datalog.log = j.log
+	size, err := j.datalog.Size()
+	if err == nil && size < j.binheap.indexed {
+		err = j.resetIndex(c, fmt.Errorf("data log is shorter than the indexed part (%d < %d bytes)", size, j.binheap.indexed))
+	}
+	if err != nil {
+		j.index.Close()
+		j.datalog.Close()
+		return nil, err
+	}
+	if err := j.rebuildIndex(ctx, j.binheap.indexed); err != nil {
+		j.index.Close()
+		j.datalog.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// OpenReadOnly opens a Jupiter stored in disk to inspect it, without
+// modifying its files.  The index is used as it is in disk: it is not
+// reset if it is not consistent, the blocks written after the last Sync
+// are not added to it, and its invalid buckets are kept, to be read with
+// Index.RawBucket.  Without a BinHeap, the index is built in memory, and
+// an incomplete block at the end of the data log is left there.
+// New blocks cannot be written, and Close does not sync.
+func OpenReadOnly(c *Config) (*Jupiter, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	var j *Jupiter
+	if c.BinHeapFile != "" {
+		bh, err := OpenBinHeap(c.BinHeapFile)
+		if err != nil {
+			return nil, err
+		}
+		j = &Jupiter{log: nopLogger{}, binheap: bh}
+		if j.index, err = OpenIndexReadOnly(c.IndexFiles[0], c.FPSize, bh.numBuckets); err != nil {
+			return nil, err
+		}
+		j.stats.blocks = bh.blocks
+		j.stats.physicalBytes = bh.bytes
+		j.stats.logicalBytes = bh.bytes
+	} else {
+		var err error
+		if j, err = newJupiter(c.FPSize, log2(c.InitialBuckets)); err != nil {
+			return nil, err
+		}
+	}
+	j.readOnly = true
+	j.config = c
+	if c.Logger != nil {
+		j.log = c.Logger
+	}
+	var err error
+	if j.datalog, err = OpenDataLogReadOnly(c.DataLogFiles[0], c.Hasher); err != nil {
+		j.index.Close()
+		return nil, err
+	}
+	j.datalog.log = j.log
+	if c.BinHeapFile == "" {
+		err = j.rebuildIndex(context.Background(), 0)
+	}
+	if err != nil {
+		j.index.Close()
+		j.datalog.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// openIndex reads the BinHeap and the index of a Jupiter from disk.
+// If they are not consistent, a new empty index is created and
+// it will be rebuilt from the data log.
+func openIndex(c *Config) (*Jupiter, error) {
+	bh, err := OpenBinHeap(c.BinHeapFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s does not exist: the store must be formatted first", c.BinHeapFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	j := &Jupiter{log: nopLogger{}, binheap: bh}
+	j.index, err = OpenIndex(c.IndexFiles[0], c.FPSize, bh.numBuckets)
+	if errors.Is(err, ErrCorrupt) {
+		return j, j.resetIndex(c, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.stats.blocks = bh.blocks
+	j.stats.physicalBytes = bh.bytes
+	j.stats.logicalBytes = bh.bytes
+	return j, nil
+}
+
+// resetIndex replaces the index stored in disk with an empty one,
+// so that it can be rebuilt from the data log.
+func (j *Jupiter) resetIndex(c *Config, reason error) error {
+	if c.Logger != nil {
+		c.Logger.Log(LevelWarn, "index is not consistent, rebuilding it", Field{"error", reason})
+	}
+	return j.emptyIndex(c)
+}
+
+// emptyIndex replaces the index with an empty one, in disk if there is
+// a BinHeap in the configuration or else in memory.
+func (j *Jupiter) emptyIndex(c *Config) error {
+	if j.index != nil {
+		j.index.Close()
+	}
+	var err error
+	if c.BinHeapFile == "" {
+		j.index = NewIndex(c.FPSize)
+	} else if j.index, err = CreateIndex(c.IndexFiles[0], c.FPSize); err != nil {
+		return err
+	}
+	if j.binheap, err = presplit(j.index, log2(c.InitialBuckets)); err != nil {
+		return err
+	}
+	j.binheap.filename = c.BinHeapFile
+	j.stats.blocks = 0
+	j.stats.logicalBytes = 0
+	j.stats.physicalBytes = 0
 	return nil
 }
 
+// reset discards every block stored in a Jupiter
+func (j *Jupiter) reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.datalog.Truncate(dataLogHeaderSize); err != nil {
+		return err
+	}
+	if err := j.emptyIndex(j.config); err != nil {
+		return err
+	}
+	j.log.Log(LevelInfo, "store reset")
+	return j.sync(context.Background())
+}
+
+// size returns the size of the data log
+func (j *Jupiter) size() (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.datalog.Size()
+}
+
+// New creates a new Jupiter without a physical back-up (data is stored in memory)
 func New() (*Jupiter, error) {
+	return NewHasher(DefaultHasher)
+}
+
+// NewHasher is like New, but the scores are computed with a given Hasher
+func NewHasher(h Hasher) (*Jupiter, error) {
+	return NewConfig(&Config{FPSize: ScoreBytesInEntry, Hasher: h})
+}
+
+// NewConfig is like New, but the index and the hash function are set up
+// as in a configuration: it uses c.FPSize, c.InitialBuckets, c.Hasher
+// and c.Logger.  The files in the configuration are ignored.
+func NewConfig(c *Config) (*Jupiter, error) {
+	if err := c.checkIndex(); err != nil {
+		return nil, err
+	}
+	j, err := newJupiter(c.FPSize, log2(c.InitialBuckets))
+	if err != nil {
+		return nil, err
+	}
+	if c.Logger != nil {
+		j.log = c.Logger
+	}
+	j.config = c
+	j.datalog = NewDataLog(c.Hasher)
+	j.datalog.log = j.log
+	return j, nil
+}
+
+// Hasher returns the Hasher used to compute the scores of the blocks
+func (j *Jupiter) Hasher() Hasher {
+	return j.datalog.Hasher()
+}
+
+// newJupiter creates a Jupiter with an empty index of 2^bits buckets and no data log
+func newJupiter(scoreBytesInEntry int, bits int) (*Jupiter, error) {
 	var j Jupiter
 	var err error
-	j.index = NewIndex(ScoreBytesInEntry)
+	j.log = nopLogger{}
+	j.index = NewIndex(scoreBytesInEntry)
+	j.binheap, err = presplit(j.index, bits)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
 
-	firstBucket, err := j.index.NewBucket(0, []byte{})
+// presplit adds 2^bits buckets to an empty index, each one for the scores
+// starting with a different combination of bits, and returns a BinHeap
+// pointing to them.
+func presplit(in *Index, bits int) (*BinHeap, error) {
+	var err error
+	next := uint32(0)
+	bh, e := NewBinHeapPresplit(bits, func() uint32 {
+		var common [4]byte
+		binary.BigEndian.PutUint32(common[:], next<<uint(32-bits))
+		next++
+		n, e := in.NewBucket(bits, common[:])
+		if err == nil {
+			err = e
+		}
+		return n
+	})
+	if e != nil {
+		return nil, e
+	}
 	if err != nil {
 		return nil, err
 	}
-	j.binheap, err = NewBinHeap(firstBucket)
+	bh.numBuckets = in.NumBuckets()
+	bh.indexed = dataLogHeaderSize
+	return bh, nil
+}
+
+// rebuildIndex adds every block in the data log from a given address to the index.
+// If the last block is incomplete (because of a crash while it was being
+// written), it is removed from the data log.
+// It stops, returning the error of the context, when ctx is done.
+func (j *Jupiter) rebuildIndex(ctx context.Context, from uint64) error {
+	end := from
+	err := j.datalog.Walk(from, func(addr uint64, s Score, t Type, size int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end = addr + chunkHeaderSize + uint64(size)
+		j.stats.addBlock(size)
+		j.stats.logicalBytes += uint64(size)
+		return j.addToIndex(s, addr)
+	})
+	if err == io.ErrUnexpectedEOF && j.readOnly {
+		j.log.Log(LevelWarn, "incomplete block at end of data log", Field{"addr", end})
+		err = nil
+	}
+	if err == io.ErrUnexpectedEOF {
+		if end < dataLogHeaderSize {
+			end = dataLogHeaderSize
+		}
+		j.log.Log(LevelWarn, "incomplete block at end of data log, truncating", Field{"addr", end})
+		err = j.datalog.Truncate(end)
+	}
+	if err == nil {
+		j.log.Log(LevelInfo, "index rebuilt", Field{"from", from}, Field{"blocks", j.stats.blocks}, Field{"buckets", j.index.NumBuckets()})
+	}
+	return err
+}
+
+// Sync commits the contents of a Jupiter to stable storage
+func (j *Jupiter) Sync() error {
+	return j.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but it stops between writes when the context
+// is done.  The BinHeap is written last, so a Jupiter whose sync was
+// stopped is still consistent.
+func (j *Jupiter) SyncContext(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sync(ctx)
+}
+
+// sync writes the data log, the index and the BinHeap, in that order:
+// the BinHeap says which part of the data log is in the index.
+// j.mu must be held.
+func (j *Jupiter) sync(ctx context.Context) error {
+	if j.readOnly {
+		return errReadOnly
+	}
+	if err := j.datalog.Sync(); err != nil {
+		return err
+	}
+	if j.binheap.filename == "" {
+		return nil
+	}
+	if err := j.index.SyncContext(ctx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	size, err := j.datalog.Size()
+	if err != nil {
+		return err
+	}
+	j.binheap.numBuckets = j.index.NumBuckets()
+	j.binheap.indexed = size
+	j.binheap.blocks = j.stats.blocks
+	j.binheap.bytes = j.stats.physicalBytes
+	return j.binheap.Sync()
+}
+
+// Close syncs and closes a Jupiter
+func (j *Jupiter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var err error
+	if !j.readOnly {
+		err = j.sync(context.Background())
+	}
+	if e := j.index.Close(); err == nil {
+		err = e
+	}
+	if e := j.datalog.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// lookup returns the possible addresses of a score in the data log.
+func (j *Jupiter) lookup(score Score) ([]uint64, error) {
+	_, buckn, err := j.binheap.GetBucket(score)
 	if err != nil {
 		return nil, err
 	}
-	j.datalog = NewDataLog()
-	return &j, nil
+	bucket, err := j.index.Bucket(buckn)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.GetAddress(score), nil
 }
 
-func (j *Jupiter) Read(score Score) (Type, []byte, error) {
-	_, buckn := j.binheap.GetBucket(score)
-	bucket := j.index.Bucket(buckn)
-	// fmt.Printf("DEBUG: Jupiter.Read: bucket=%v\n", bucket)
-	addrs := bucket.GetAddress(score)
+// find returns the address and type of a block, or ErrNotFound if it is
+// not stored.
+func (j *Jupiter) find(score Score) (addr uint64, t Type, err error) {
+	addrs, err := j.lookup(score)
+	if err != nil {
+		return 0, 0, err
+	}
 	for _, addr := range addrs {
+		t, err := j.datalog.PeekChunk(score, addr)
+		if err == nil {
+			return addr, t, nil
+		}
+	}
+	return 0, 0, ErrNotFound
+}
+
+// Has reports whether a block is stored
+func (j *Jupiter) Has(score Score) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, _, err := j.find(score)
+	return err == nil
+}
+
+// Stat returns the type and size of a stored block, without reading it
+func (j *Jupiter) Stat(score Score) (Type, int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	addr, _, err := j.find(score)
+	if err != nil {
+		return 0, 0, fmt.Errorf("jupiter: Stat(%s): %w", score, err)
+	}
+	_, t, size, err := j.datalog.readHeader(addr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("jupiter: Stat(%s): %w", score, err)
+	}
+	return t, size, nil
+}
+
+// ResolveScore returns the score of a stored block, given its full
+// value or its first hexadecimal digits (as with git short hashes).
+// The score may be tagged with the name of its hash algorithm, as
+// written by TagScore, which must be the one used by the store.
+// It returns ErrNotFound if no block matches, and ErrAmbiguous if
+// more than one does.
+func (j *Jupiter) ResolveScore(prefix string) (Score, error) {
+	p, bits, err := parseScorePrefix(prefix)
+	if i := strings.IndexByte(prefix, ':'); i >= 0 {
+		if name := prefix[:i]; name != j.Hasher().Name() {
+			return ZeroScore, fmt.Errorf("jupiter: ResolveScore(%s): the store uses %s, not %s: %w", prefix, j.Hasher().Name(), name, ErrNotFound)
+		}
+		p, bits, err = parseScorePrefix(prefix[i+1:])
+	}
+	if err != nil {
+		return ZeroScore, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if bits == 8*ScoreSize {
+		if _, _, err := j.find(p); err != nil {
+			return ZeroScore, fmt.Errorf("jupiter: ResolveScore(%s): %w", prefix, err)
+		}
+		return p, nil
+	}
+	buckets, err := j.binheap.GetBuckets(p, bits)
+	if err != nil {
+		return ZeroScore, err
+	}
+	var found []Score
+	seen := make(map[Score]bool)
+	for _, n := range buckets {
+		bucket, err := j.index.Bucket(n)
+		if err != nil {
+			return ZeroScore, err
+		}
+		for _, e := range bucket.entries() {
+			if !p.Match(e.score, minInt(e.mask, bits)) {
+				continue
+			}
+			s, _, _, err := j.datalog.readHeader(e.addr)
+			if err != nil || !s.Match(p, bits) || seen[s] {
+				continue
+			}
+			seen[s] = true
+			found = append(found, s)
+		}
+		if len(found) > 1 {
+			break
+		}
+	}
+	switch len(found) {
+	case 0:
+		return ZeroScore, fmt.Errorf("jupiter: ResolveScore(%s): %w", prefix, ErrNotFound)
+	case 1:
+		return found[0], nil
+	}
+	return ZeroScore, fmt.Errorf("jupiter: ResolveScore(%s): %w", prefix, ErrAmbiguous)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readChunk reads a block from any of its possible addresses.
+// If none of them has the block, it returns the last CorruptionError
+// found, or ErrNotFound.  It stops when the context is done.
+func (j *Jupiter) readChunk(ctx context.Context, score Score, addrs []uint64) (Type, []byte, error) {
+	var lastErr error = ErrNotFound
+	for _, addr := range addrs {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, err
+		}
 		t, b, err := j.datalog.ReadChunk(score, addr)
 		if err == nil {
 			return t, b, nil
 		}
+		var cerr *CorruptionError
+		if errors.As(err, &cerr) {
+			lastErr = err
+		}
 	}
-	return 0, nil, fmt.Errorf("jupiter: Read(%s): not found", score)
+	return 0, nil, lastErr
+}
+
+func (j *Jupiter) Read(score Score) (Type, []byte, error) {
+	return j.ReadContext(context.Background(), score)
+}
+
+// ReadContext is like Read, but it gives up when the context is done
+// before the block has been read.
+func (j *Jupiter) ReadContext(ctx context.Context, score Score) (Type, []byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	defer j.stats.observe("read", time.Now())
+	addrs, err := j.lookup(score)
+	if err != nil {
+		return 0, nil, fmt.Errorf("jupiter: Read(%s): %w", score, err)
+	}
+	t, b, err := j.readChunk(ctx, score, addrs)
+	if err != nil {
+		return 0, nil, fmt.Errorf("jupiter: Read(%s): %w", score, err)
+	}
+	return t, b, nil
 }
 
 func (j *Jupiter) Write(t Type, b []byte) (Score, error) {
-	score := GetScore(b)
-	_, buckn := j.binheap.GetBucket(score)
-	bucket := j.index.Bucket(buckn)
-	addrs := bucket.GetAddress(score)
-	for _, addr := range addrs {
-		tt, err := j.datalog.PeekChunk(score, addr)
-		if t == tt && err == nil {
-			return score, nil
-		}
-		if t != tt && err == nil {
-			return ZeroScore, fmt.Errorf("Jupiter.Write(): block already written with different type")
+	return j.WriteContext(context.Background(), t, b)
+}
+
+// WriteContext is like Write, but it gives up when the context is done
+// before the block is written.  A block is written with a single append
+// to the data log, so it is either stored or not.
+func (j *Jupiter) WriteContext(ctx context.Context, t Type, b []byte) (Score, error) {
+	score, _, err := j.store(ctx, t, b)
+	return score, err
+}
+
+// store is like WriteContext, but it also reports whether the block was not
+// already stored.
+func (j *Jupiter) store(ctx context.Context, t Type, b []byte) (Score, bool, error) {
+	start := time.Now()
+	// the hasher never changes, so the block is hashed before locking
+	// and concurrent writers hash their blocks in parallel
+	score := j.datalog.hasher.Sum(b)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	defer j.stats.observe("write", start)
+	if err := ctx.Err(); err != nil {
+		return ZeroScore, false, fmt.Errorf("jupiter: Write(): %w", err)
+	}
+	return j.write(score, t, b)
+}
+
+// write stores a block with a given score, and reports whether it was
+// not already stored.  j.mu must be held.
+func (j *Jupiter) write(score Score, t Type, b []byte) (Score, bool, error) {
+	_, tt, err := j.find(score)
+	if err == nil {
+		if t != tt {
+			return ZeroScore, false, fmt.Errorf("Jupiter.Write(): block already written with type %d: %w", tt, ErrTypeMismatch)
 		}
+		j.stats.logicalBytes += uint64(len(b))
+		return score, false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return ZeroScore, false, err
+	}
+	if j.readOnly {
+		return ZeroScore, false, errReadOnly
 	}
 	addr, err := j.datalog.WriteChunk(score, t, b)
 	if err != nil {
-		return ZeroScore, err
+		return ZeroScore, false, err
+	}
+	if err := j.addToIndex(score, addr); err != nil {
+		return ZeroScore, false, j.unwrite(addr, err)
+	}
+	j.stats.addBlock(len(b))
+	j.stats.logicalBytes += uint64(len(b))
+	return score, true, nil
+}
+
+// unwrite removes the blocks appended to the data log from addr on, after
+// their entries could not be added to the index, so that every block in
+// the log is in the index.  The entries that were added point to no block,
+// and they are ignored by the lookups.  It returns err.
+func (j *Jupiter) unwrite(addr uint64, err error) error {
+	if e := j.datalog.Truncate(addr); e != nil {
+		j.log.Log(LevelError, "cannot remove blocks not in the index", Field{"addr", addr}, Field{"error", e})
+	}
+	return err
+}
+
+// addToIndex adds an entry to the index, splitting buckets when needed.
+func (j *Jupiter) addToIndex(score Score, addr uint64) error {
+	for {
+		k, buckn, err := j.binheap.GetBucket(score)
+		if err != nil {
+			return err
+		}
+		bucket, err := j.index.Bucket(buckn)
+		if err != nil {
+			return err
+		}
+		ok, err := bucket.Add(score, addr)
+		if err != nil {
+			return err
+		}
+		if ok {
+			j.index.markDirty(buckn)
+			j.log.Log(LevelDebug, "index entry added", Field{"score", score}, Field{"addr", addr}, Field{"bucket", buckn})
+			return nil
+		}
+		// There is no room in bucket, we need another one
+		if err := j.splitBucket(k, buckn); err != nil {
+			return err
+		}
+	}
+}
+
+// splitBucket divides the bucket in the leaf k of the binary heap into two.
+// The bucket keeps the lower half of the entries, and a new bucket is allocated
+// for the upper half.
+func (j *Jupiter) splitBucket(k int, buckn uint32) error {
+	bucket, err := j.index.Bucket(buckn)
+	if err != nil {
+		return err
+	}
+	common, mask := bucket.CommonScore()
+	setBit(common.s[:], mask, true)
+	newn, err := j.index.NewBucket(mask+1, common.s[:])
+	if err != nil {
+		return err
+	}
+	newBucket, err := j.index.Bucket(newn)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Split(newBucket); err != nil {
+		return err
 	}
-	if bucket.Add(score, addr) {
-		return score, nil
+	j.index.markDirty(buckn)
+	j.index.markDirty(newn)
+	j.log.Log(LevelInfo, "bucket split", Field{"bucket", buckn}, Field{"new", newn}, Field{"bits", mask + 1})
+	return j.binheap.NewLeaf(k, newn)
+}
+
+// A Block is a piece of data together with its type.
+type Block struct {
+	Type Type
+	Data []byte
+}
+
+// WriteBatch stores several blocks at once, and returns their scores.
+// The new blocks are appended to the data log in a single write, and the
+// index is updated grouping the entries by bucket.
+func (j *Jupiter) WriteBatch(blocks []Block) ([]Score, error) {
+	// the hasher never changes, so blocks can be hashed before locking
+	data := make([][]byte, len(blocks))
+	for i := range blocks {
+		data[i] = blocks[i].Data
+	}
+	scores := sumBlocks(j.datalog.hasher, data)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	defer j.stats.observe("writebatch", time.Now())
+	type pending struct {
+		score Score
+		buckn uint32
+		addr  uint64
+	}
+	seen := make(map[Score]Type)
+	var news []pending
+	var newTypes []Type
+	var newData [][]byte
+	var logical uint64
+	for i, block := range blocks {
+		score := scores[i]
+		logical += uint64(len(block.Data))
+		t, ok := seen[score]
+		if !ok {
+			var err error
+			_, t, err = j.find(score)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			ok = err == nil
+		}
+		if ok {
+			if t != block.Type {
+				return nil, fmt.Errorf("Jupiter.WriteBatch(): block %d already written with type %d: %w", i, t, ErrTypeMismatch)
+			}
+			continue
+		}
+		seen[score] = block.Type
+		_, buckn, err := j.binheap.GetBucket(score)
+		if err != nil {
+			return nil, err
+		}
+		news = append(news, pending{score: score, buckn: buckn})
+		newTypes = append(newTypes, block.Type)
+		newData = append(newData, block.Data)
+	}
+	if len(news) == 0 {
+		j.stats.logicalBytes += logical
+		return scores, nil
+	}
+	if j.readOnly {
+		return nil, errReadOnly
+	}
+	newScores := make([]Score, len(news))
+	for i := range news {
+		newScores[i] = news[i].score
+	}
+	addrs, err := j.datalog.WriteChunks(newScores, newTypes, newData)
+	if err != nil {
+		return nil, err
+	}
+	for i := range news {
+		news[i].addr = addrs[i]
+	}
+	sort.SliceStable(news, func(a, b int) bool {
+		return news[a].buckn < news[b].buckn
+	})
+	for _, p := range news {
+		if err := j.addToIndex(p.score, p.addr); err != nil {
+			return nil, j.unwrite(addrs[0], err)
+		}
+	}
+	for _, b := range newData {
+		j.stats.addBlock(len(b))
+	}
+	j.stats.logicalBytes += logical
+	return scores, nil
+}
+
+// ReadBatch returns the blocks identified by several scores.
+// The blocks are read from the data log in address order.
+func (j *Jupiter) ReadBatch(scores []Score) ([]Block, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	defer j.stats.observe("readbatch", time.Now())
+	type pending struct {
+		i     int
+		addrs []uint64
+	}
+	list := make([]pending, len(scores))
+	for i, score := range scores {
+		addrs, err := j.lookup(score)
+		if err != nil {
+			return nil, fmt.Errorf("jupiter: ReadBatch(%s): %w", score, err)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("jupiter: ReadBatch(%s): %w", score, ErrNotFound)
+		}
+		list[i] = pending{i: i, addrs: addrs}
+	}
+	sort.SliceStable(list, func(a, b int) bool {
+		return list[a].addrs[0] < list[b].addrs[0]
+	})
+	blocks := make([]Block, len(scores))
+	for _, p := range list {
+		score := scores[p.i]
+		t, b, err := j.readChunk(context.Background(), score, p.addrs)
+		if err != nil {
+			return nil, fmt.Errorf("jupiter: ReadBatch(%s): %w", score, err)
+		}
+		blocks[p.i] = Block{Type: t, Data: b}
 	}
-	// There is no room in bucket, we need another one
-	// j.index.NewBucket(numScoreCommonBits int, scoreCommonBytes []byte) (uint32, error) {
-	// bucket.Split(b2 *Bucket) error {
-	// j.binheap.NewLeaf(k int, v uint32) error {
-	panic("Jupiter.Write(): creating new bucket: not implemented")
-	return ZeroScore, nil
+	return blocks, nil
 }
@@ -0,0 +1,161 @@
+package jupiter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	var scores []Score
+	for i := 0; i < 3000; i++ {
+		s, err := j.Write(Type(i%3), []byte(fmt.Sprintf("block %d", i)))
+		if err != nil {
+			t.Fatalf("Write(%d): %v", i, err)
+		}
+		scores = append(scores, s)
+	}
+	if j.index.NumBuckets() < 2 {
+		t.Errorf("index has %d buckets (should have split)", j.index.NumBuckets())
+	}
+	for i, s := range scores {
+		typ, b, err := j.Read(s)
+		if err != nil {
+			t.Fatalf("Read(%s): %v", s, err)
+		}
+		if typ != Type(i%3) || string(b) != fmt.Sprintf("block %d", i) {
+			t.Errorf("Read(%s) = (%d,%q)", s, typ, b)
+		}
+	}
+	if _, err := j.Write(1, []byte("block 0")); err == nil {
+		t.Errorf("Write() with a different type should return error")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	j, err := NewConfig(&Config{FPSize: ScoreBytesInEntry, InitialBuckets: 256, Hasher: SHA256})
+	if err != nil {
+		t.Fatalf("NewConfig(): %v", err)
+	}
+	if j.index.NumBuckets() != 256 || j.binheap.Depth() != 8 || j.Hasher() != SHA256 {
+		t.Errorf("NewConfig(): %d buckets, depth %d, hasher %s", j.index.NumBuckets(), j.binheap.Depth(), j.Hasher().Name())
+	}
+	for i := 0; i < 3000; i++ {
+		b := []byte(fmt.Sprintf("block %d", i))
+		if _, err := j.Write(1, b); err != nil {
+			t.Fatalf("Write(%d): %v", i, err)
+		}
+		if !j.Has(SHA256.Sum(b)) {
+			t.Fatalf("block %d not found after writing it", i)
+		}
+	}
+	if j.index.NumBuckets() != 256 {
+		t.Errorf("index with 256 initial buckets has split: %d buckets", j.index.NumBuckets())
+	}
+	if _, err := NewConfig(&Config{FPSize: ScoreBytesInEntry, InitialBuckets: 3}); err == nil {
+		t.Errorf("NewConfig() with 3 initial buckets should fail")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	var blocks []Block
+	for i := 0; i < 2000; i++ {
+		blocks = append(blocks, Block{Type: 1, Data: []byte(fmt.Sprintf("block %d", i%1500))})
+	}
+	scores, err := j.WriteBatch(blocks)
+	if err != nil {
+		t.Fatalf("WriteBatch(): %v", err)
+	}
+	if len(scores) != len(blocks) {
+		t.Fatalf("WriteBatch() returned %d scores (should be %d)", len(scores), len(blocks))
+	}
+	if scores[0] != scores[1500] {
+		t.Errorf("duplicate blocks have different scores")
+	}
+	size, _ := j.datalog.fp.Seek(0, 2)
+	scores2, err := j.WriteBatch(blocks[:10])
+	if err != nil {
+		t.Fatalf("WriteBatch(): %v", err)
+	}
+	if size2, _ := j.datalog.fp.Seek(0, 2); size2 != size {
+		t.Errorf("rewriting blocks grew data log from %d to %d bytes", size, size2)
+	}
+	for i := range scores2 {
+		if scores2[i] != scores[i] {
+			t.Errorf("score %d changed", i)
+		}
+	}
+	read, err := j.ReadBatch(scores)
+	if err != nil {
+		t.Fatalf("ReadBatch(): %v", err)
+	}
+	for i := range read {
+		if read[i].Type != blocks[i].Type || !bytes.Equal(read[i].Data, blocks[i].Data) {
+			t.Errorf("ReadBatch()[%d] = (%d,%q)", i, read[i].Type, read[i].Data)
+		}
+	}
+	if _, err := j.ReadBatch([]Score{ZeroScore}); err == nil {
+		t.Errorf("ReadBatch() of a missing block should return error")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("# test\nlisten :17034\ndata data.log\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	if c.ListenPort != 17034 || c.DataLogFiles[0] != filepath.Join(dir, "data.log") {
+		t.Errorf("ReadConfig() = %+v", c)
+	}
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	var scores []Score
+	for i := 0; i < 1000; i++ {
+		s, err := j.Write(2, []byte(fmt.Sprintf("block %d", i)))
+		if err != nil {
+			t.Fatalf("Write(%d): %v", i, err)
+		}
+		scores = append(scores, s)
+	}
+	j.Close()
+
+	// add an incomplete block at the end, as if it crashed while writing
+	f, _ := os.OpenFile(c.DataLogFiles[0], os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("garbage"))
+	f.Close()
+
+	j, err = Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	defer j.Close()
+	for i, s := range scores {
+		typ, b, err := j.Read(s)
+		if err != nil || typ != 2 || string(b) != fmt.Sprintf("block %d", i) {
+			t.Errorf("Read(%s) = (%d,%q,%v)", s, typ, b, err)
+		}
+	}
+	if _, err := j.Write(2, []byte("one more")); err != nil {
+		t.Errorf("Write(): %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package jupiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits has the quotas and rate limits of the clients of a Server, by
+// identity (see Auth).  An identity without its own limits has the ones
+// of AnyIdentity, if any.  Clients which are not authenticated are
+// accounted together, as AnyIdentity.
+//
+// Only new blocks count for the quotas: writing a block which is already
+// stored is always allowed.  The bytes written are counted since the
+// Server started.
+type Limits struct {
+	Quotas     map[string]uint64  // bytes of new blocks each identity can write
+	RateLimits map[string]float64 // requests per second of each identity
+}
+
+// quota returns the quota of an identity, and whether it has one
+func (l *Limits) quota(identity string) (uint64, bool) {
+	if l == nil {
+		return 0, false
+	}
+	q, ok := l.Quotas[identity]
+	if !ok {
+		q, ok = l.Quotas[AnyIdentity]
+	}
+	return q, ok
+}
+
+// rate returns the rate limit of an identity, and whether it has one
+func (l *Limits) rate(identity string) (float64, bool) {
+	if l == nil {
+		return 0, false
+	}
+	r, ok := l.RateLimits[identity]
+	if !ok {
+		r, ok = l.RateLimits[AnyIdentity]
+	}
+	return r, ok
+}
+
+// Limits returns the quotas and rate limits in a configuration, or nil
+// if there are none
+func (c *Config) Limits() *Limits {
+	if len(c.Quotas) == 0 && len(c.RateLimits) == 0 {
+		return nil
+	}
+	return &Limits{Quotas: c.Quotas, RateLimits: c.RateLimits}
+}
+
+// ClientMetrics has the usage of a Server by one identity
+type ClientMetrics struct {
+	Requests     uint64 `json:"requests"`
+	WrittenBytes uint64 `json:"written_bytes"` // of new blocks
+	Blocks       uint64 `json:"blocks"`        // new blocks written
+	QuotaBytes   uint64 `json:"quota_bytes,omitempty"`
+	QuotaDenied  uint64 `json:"quota_denied"`
+	RateDenied   uint64 `json:"rate_denied"`
+}
+
+// clientUsage is what a Server knows about the clients with one identity.
+// It is protected by usageMap.mu.
+type clientUsage struct {
+	ClientMetrics
+	pending uint64    // bytes being written
+	tokens  float64   // requests allowed now by the rate limit
+	last    time.Time // when tokens was computed
+}
+
+// allow reports whether a request can be done now with a rate limit of
+// rate requests per second, allowing bursts of up to a second of requests
+func (u *clientUsage) allow(rate float64, now time.Time) bool {
+	burst := math.Max(1, rate)
+	if u.last.IsZero() {
+		u.tokens = burst
+	} else {
+		u.tokens = math.Min(burst, u.tokens+now.Sub(u.last).Seconds()*rate)
+	}
+	u.last = now
+	if u.tokens < 1 {
+		return false
+	}
+	u.tokens--
+	return true
+}
+
+// usageMap has the usage of a Server by each identity
+type usageMap struct {
+	mu      sync.Mutex
+	clients map[string]*clientUsage
+}
+
+// client returns the usage of an identity.  u.mu must be held.
+func (u *usageMap) client(identity string) *clientUsage {
+	if identity == "" {
+		identity = AnyIdentity
+	}
+	if u.clients == nil {
+		u.clients = make(map[string]*clientUsage)
+	}
+	c := u.clients[identity]
+	if c == nil {
+		c = &clientUsage{}
+		u.clients[identity] = c
+	}
+	return c
+}
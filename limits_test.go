@@ -0,0 +1,191 @@
+package jupiter
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "jupiter.conf")
+	ioutil.WriteFile(conf, []byte("data data.log\nquota alice 2G\nquota * 1000\nratelimit alice 0.5\n"), 0644)
+	c, err := ReadConfig(conf)
+	if err != nil {
+		t.Fatalf("ReadConfig(): %v", err)
+	}
+	l := c.Limits()
+	if q, ok := l.quota("alice"); !ok || q != 2<<30 {
+		t.Errorf("quota(alice) = %d, %v", q, ok)
+	}
+	if q, ok := l.quota("bob"); !ok || q != 1000 {
+		t.Errorf("quota(bob) = %d, %v", q, ok)
+	}
+	if r, ok := l.rate("alice"); !ok || r != 0.5 {
+		t.Errorf("rate(alice) = %g, %v", r, ok)
+	}
+	if _, ok := l.rate("bob"); ok {
+		t.Errorf("rate(bob) should not be limited")
+	}
+
+	for _, bad := range []string{"quota alice\n", "quota alice 1X\n", "quota alice 99999999999T\n", "ratelimit alice 0\n", "ratelimit alice fast\n"} {
+		ioutil.WriteFile(conf, []byte("data data.log\n"+bad), 0644)
+		if _, err := ReadConfig(conf); err == nil {
+			t.Errorf("ReadConfig() with %q should fail", bad)
+		}
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := NewServer(j)
+	srv.Auth = &Auth{
+		Tokens:      map[string]string{"a": "alice", "b": "bob"},
+		Permissions: map[string]Permission{AnyIdentity: PermWrite},
+	}
+	srv.Limits = &Limits{
+		Quotas:     map[string]uint64{"alice": 10},
+		RateLimits: map[string]float64{"bob": 2},
+	}
+	go srv.Serve(l)
+	addr := l.Addr().String()
+
+	// only new blocks count for the quota
+	alice, err := DialWithOptions(addr, &ClientOptions{Token: "a"})
+	if err != nil {
+		t.Fatalf("DialWithOptions(): %v", err)
+	}
+	defer alice.Close()
+	for _, s := range []string{"hello", "world", "hello"} {
+		if _, err := alice.Write(1, []byte(s)); err != nil {
+			t.Errorf("Write(%q): %v", s, err)
+		}
+	}
+	if _, err := alice.Write(1, []byte("again")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write() over quota: %v, want ErrQuotaExceeded", err)
+	}
+	anon, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	defer anon.Close()
+	if _, err := anon.Write(1, []byte("again")); err != nil {
+		t.Errorf("Write() without quota: %v", err)
+	}
+	if _, err := alice.Write(1, []byte("again")); err != nil {
+		t.Errorf("Write() of a stored block over quota: %v", err)
+	}
+
+	// bob can do bursts of 2 requests
+	bob, err := DialWithOptions(addr, &ClientOptions{Token: "b"})
+	if err != nil {
+		t.Fatalf("DialWithOptions(): %v", err)
+	}
+	defer bob.Close()
+	for i := 0; i < 2; i++ {
+		if _, _, err := bob.Read(ZeroScore); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Read(): %v, want ErrNotFound", err)
+		}
+	}
+	if _, _, err := bob.Read(ZeroScore); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Read() over the rate limit: %v, want ErrRateLimited", err)
+	}
+
+	h := NewStatsHandler(j)
+	h.AddServer(srv)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var m Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatalf("/stats: %v", err)
+	}
+	want := ClientMetrics{Requests: 5, WrittenBytes: 10, Blocks: 2, QuotaBytes: 10, QuotaDenied: 1}
+	if m.Clients["alice"] != want {
+		t.Errorf("/stats: alice = %+v, want %+v", m.Clients["alice"], want)
+	}
+	if c := m.Clients[AnyIdentity]; c.WrittenBytes != 5 || c.QuotaBytes != 0 {
+		t.Errorf("/stats: %s = %+v", AnyIdentity, c)
+	}
+	if c := m.Clients["bob"]; c.Requests != 3 || c.RateDenied != 1 {
+		t.Errorf("/stats: bob = %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, s := range []string{`jupiter_client_written_bytes_total{client="alice"} 10`, `jupiter_client_denied_total{client="bob",reason="rate"} 1`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("/metrics does not contain %q", s)
+		}
+	}
+}
+
+func TestGatewayLimits(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	srv := NewServer(j)
+	srv.Limits = &Limits{
+		Quotas:     map[string]uint64{"alice": 10},
+		RateLimits: map[string]float64{"bob": 2},
+	}
+	srv.Auth = &Auth{
+		Tokens:      map[string]string{"a": "alice", "b": "bob"},
+		Permissions: map[string]Permission{AnyIdentity: PermWrite},
+	}
+	gw := NewGateway(j)
+	gw.Server = srv
+	ts := httptest.NewServer(srv.HTTPHandler(gw))
+	defer ts.Close()
+
+	// writes through the gateway count for the quota of the Server
+	alice := NewClientWithOptions(ts.URL, &ClientOptions{Token: "a"})
+	for _, s := range []string{"hello", "world", "hello"} {
+		if _, err := alice.Write(1, []byte(s)); err != nil {
+			t.Errorf("Write(%q): %v", s, err)
+		}
+	}
+	if _, err := alice.Write(1, []byte("again")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write() over quota: %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := NewClient(ts.URL).Write(1, []byte("again")); err != nil {
+		t.Errorf("Write() without quota: %v", err)
+	}
+
+	bob := NewClientWithOptions(ts.URL, &ClientOptions{Token: "b"})
+	for i := 0; i < 2; i++ {
+		if _, _, err := bob.Read(ZeroScore); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Read(): %v, want ErrNotFound", err)
+		}
+	}
+	if _, _, err := bob.Read(ZeroScore); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Read() over the rate limit: %v, want ErrRateLimited", err)
+	}
+
+	usage := srv.Usage()
+	if c := usage["alice"]; c.Requests != 4 || c.WrittenBytes != 10 || c.QuotaDenied != 1 {
+		t.Errorf("Usage(): alice = %+v", c)
+	}
+	if c := usage["bob"]; c.Requests != 3 || c.RateDenied != 1 {
+		t.Errorf("Usage(): bob = %+v", c)
+	}
+}
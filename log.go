@@ -0,0 +1,118 @@
+package jupiter
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level" + strconv.Itoa(int(l))
+}
+
+// ParseLevel returns the Level with a given name
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// A Field is a key-value pair attached to a log message,
+// such as the score of a block or its address in the data log.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// A Logger receives the log messages of a Jupiter.
+// The contents of the blocks are never logged.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// nopLogger discards all the messages.  It is the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// textLogger writes messages as lines of key=value pairs.
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+// NewTextLogger returns a Logger which writes a line for every message
+// of level min or higher, in the form:
+//
+//	time=2020-01-02T15:04:05Z level=info msg="bucket split" bucket=1 new=2
+func NewTextLogger(w io.Writer, min Level) Logger {
+	return &textLogger{w: w, min: min}
+}
+
+func (l *textLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "time=%s level=%s msg=%s", time.Now().UTC().Format(time.RFC3339), level, logValue(msg))
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%s", f.Key, logValue(fmt.Sprint(f.Value)))
+	}
+	b.WriteByte('\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logValue quotes a value if needed
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// SetLogger sets the Logger used by a Jupiter.  By default, nothing is logged.
+func (j *Jupiter) SetLogger(l Logger) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if l == nil {
+		l = nopLogger{}
+	}
+	j.log = l
+	j.datalog.log = l
+}
+
+// logger returns the Logger of a Jupiter
+func (j *Jupiter) logger() Logger {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log
+}
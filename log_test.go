@@ -0,0 +1,35 @@
+package jupiter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	j.SetLogger(NewTextLogger(&buf, LevelDebug))
+	score, _ := j.Write(1, []byte("secret payload"))
+	j.Read(score)
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("block contents were logged: %s", out)
+	}
+	if !strings.Contains(out, `level=debug msg="chunk written" score=`+score.String()+" type=1 size=14 addr=8") {
+		t.Errorf("unexpected log: %s", out)
+	}
+
+	buf.Reset()
+	j.SetLogger(NewTextLogger(&buf, LevelInfo))
+	j.Write(1, []byte("another block"))
+	if buf.Len() != 0 {
+		t.Errorf("debug messages logged with level info: %s", buf.String())
+	}
+	if l, err := ParseLevel("warn"); err != nil || l != LevelWarn {
+		t.Errorf("ParseLevel(warn) = %v, %v", l, err)
+	}
+}
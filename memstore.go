@@ -0,0 +1,89 @@
+package jupiter
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A MemStore is a Store which keeps its blocks in a map.  It has no index
+// or data log, so it is useful for tests and small temporary stores.
+type MemStore struct {
+	hasher Hasher
+
+	mu     sync.Mutex
+	blocks map[Score]memBlock
+}
+
+type memBlock struct {
+	t Type
+	b []byte
+}
+
+// NewMemStore returns an empty MemStore which computes the scores with
+// a given Hasher, or DefaultHasher if it is nil.
+func NewMemStore(h Hasher) *MemStore {
+	if h == nil {
+		h = DefaultHasher
+	}
+	return &MemStore{hasher: h, blocks: make(map[Score]memBlock)}
+}
+
+// Hasher returns the Hasher used to compute the scores of the blocks
+func (m *MemStore) Hasher() Hasher {
+	return m.hasher
+}
+
+// Read returns the type and contents of a block.
+// The returned slice must not be modified.
+func (m *MemStore) Read(score Score) (Type, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mb, ok := m.blocks[score]
+	if !ok {
+		return 0, nil, fmt.Errorf("jupiter: MemStore.Read(%s): %w", score, ErrNotFound)
+	}
+	return mb.t, mb.b, nil
+}
+
+// Write stores a copy of a block and returns its score
+func (m *MemStore) Write(t Type, b []byte) (Score, error) {
+	if len(b) > MaxChunkSize {
+		return ZeroScore, fmt.Errorf("jupiter: MemStore.Write(): %d bytes: %w", len(b), ErrTooLarge)
+	}
+	score := m.hasher.Sum(b)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mb, ok := m.blocks[score]; ok {
+		if mb.t != t {
+			return ZeroScore, fmt.Errorf("jupiter: MemStore.Write(): block already written with type %d: %w", mb.t, ErrTypeMismatch)
+		}
+		return score, nil
+	}
+	m.blocks[score] = memBlock{t: t, b: append([]byte(nil), b...)}
+	return score, nil
+}
+
+// Has reports whether a block is stored
+func (m *MemStore) Has(score Score) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.blocks[score]
+	return ok
+}
+
+// Len returns the number of blocks stored
+func (m *MemStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.blocks)
+}
+
+// Sync does nothing: the blocks of a MemStore are never stored in disk
+func (m *MemStore) Sync() error {
+	return nil
+}
+
+// Close does nothing
+func (m *MemStore) Close() error {
+	return nil
+}
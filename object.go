@@ -0,0 +1,401 @@
+package jupiter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Large objects are split into blocks of type ObjectDataType, and their
+// scores are stored in a tree of pointer blocks, like in Venti.
+// A pointer block at depth n (n >= 1) has type ObjectPointerType+n-1,
+// and it contains a list of entries, each one with the score of a block
+// and the number of bytes of data under it.
+// The root of the tree identifies the whole object.
+const (
+	ObjectDataType    Type = 0x10
+	ObjectPointerType Type = 0x20
+	ObjectMaxDepth         = 16
+
+	ObjectBlockSize  = 8192 // default size of each data block
+	pointerEntrySize = ScoreSize + 8
+)
+
+// pointerDepth returns the depth of a pointer block in a tree,
+// or 0 if t is not a pointer type.
+func pointerDepth(t Type) int {
+	if t >= ObjectPointerType && t < ObjectPointerType+ObjectMaxDepth {
+		return int(t-ObjectPointerType) + 1
+	}
+	return 0
+}
+
+type pointerEntry struct {
+	score Score
+	size  uint64
+}
+
+func appendPointerEntry(b []byte, e pointerEntry) []byte {
+	b = append(b, e.score.s[:]...)
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], e.size)
+	return append(b, size[:]...)
+}
+
+func parsePointerBlock(b []byte) ([]pointerEntry, error) {
+	if len(b)%pointerEntrySize != 0 {
+		return nil, fmt.Errorf("jupiter: invalid pointer block of %d bytes: %w", len(b), ErrCorrupt)
+	}
+	entries := make([]pointerEntry, len(b)/pointerEntrySize)
+	for i := range entries {
+		copy(entries[i].score.s[:], b[i*pointerEntrySize:])
+		entries[i].size = binary.BigEndian.Uint64(b[i*pointerEntrySize+ScoreSize:])
+	}
+	return entries, nil
+}
+
+// An ObjectWriter splits a stream of data into blocks, stores them in
+// a Jupiter (or another BlockWriter) and builds a tree of pointer blocks
+// with their scores.  After calling Close, Score returns the root of the tree.
+type ObjectWriter struct {
+	j       BlockWriter
+	chunker Chunker
+	fanout  int
+	buf     []byte
+	levels  [][]pointerEntry // entries not yet written, per depth
+	root    Score
+	closed  bool
+	err     error
+	stats   ObjectStats
+}
+
+// ObjectStats has the number of bytes and blocks of data written in
+// an object, and how many of them were not already in the store.
+type ObjectStats struct {
+	Bytes        uint64
+	Blocks       uint64
+	StoredBytes  uint64
+	StoredBlocks uint64
+}
+
+// DedupRatio returns the number of bytes written divided by the number of
+// bytes actually stored.
+func (s ObjectStats) DedupRatio() float64 {
+	if s.StoredBytes == 0 {
+		return 0
+	}
+	return float64(s.Bytes) / float64(s.StoredBytes)
+}
+
+func (s ObjectStats) String() string {
+	return fmt.Sprintf("%d bytes in %d blocks, %d bytes stored in %d new blocks, dedup ratio %.2f",
+		s.Bytes, s.Blocks, s.StoredBytes, s.StoredBlocks, s.DedupRatio())
+}
+
+// NewObjectWriter returns an ObjectWriter which stores its data in j,
+// using the default content-defined chunker.
+func NewObjectWriter(j BlockWriter) *ObjectWriter {
+	return NewObjectWriterChunker(j, DefaultChunker())
+}
+
+// NewObjectWriterSize returns an ObjectWriter which uses data and pointer
+// blocks of a given size.  Pointer blocks have at most the MaxFanout
+// entries of j, if it has that method (as EncryptedStore).
+func NewObjectWriterSize(j BlockWriter, blockSize int) *ObjectWriter {
+	if blockSize > MaxChunkSize {
+		blockSize = MaxChunkSize
+	}
+	if blockSize < 2*pointerEntrySize {
+		blockSize = 2 * pointerEntrySize
+	}
+	return &ObjectWriter{
+		j:       j,
+		chunker: FixedChunker{Size: blockSize},
+		fanout:  limitFanout(j, blockSize/pointerEntrySize),
+	}
+}
+
+// NewObjectWriterChunker returns an ObjectWriter which uses a given Chunker
+// to split the data in blocks.
+func NewObjectWriterChunker(j BlockWriter, c Chunker) *ObjectWriter {
+	return &ObjectWriter{
+		j:       j,
+		chunker: c,
+		fanout:  limitFanout(j, ObjectBlockSize/pointerEntrySize),
+	}
+}
+
+// limitFanout returns the number of entries in the pointer blocks
+// written to j: fanout, or the MaxFanout of j if it is lower
+func limitFanout(j BlockWriter, fanout int) int {
+	if x, ok := j.(interface{ MaxFanout() int }); ok && x.MaxFanout() < fanout {
+		return x.MaxFanout()
+	}
+	return fanout
+}
+
+// Write stores the contents of p, writing every complete data block.
+func (w *ObjectWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, errors.New("jupiter: ObjectWriter: write after close")
+	}
+	max := w.chunker.MaxSize()
+	n := 0
+	for len(p) > 0 {
+		l := max - len(w.buf)
+		if l > len(p) {
+			l = len(p)
+		}
+		w.buf = append(w.buf, p[:l]...)
+		p = p[l:]
+		n += l
+		if len(w.buf) >= max {
+			if err := w.flush(w.chunker.Cut(w.buf)); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush writes the first n bytes of the buffer as a data block
+func (w *ObjectWriter) flush(n int) error {
+	score, stored, err := w.store(ObjectDataType, w.buf[:n])
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.stats.Bytes += uint64(n)
+	w.stats.Blocks++
+	if stored {
+		w.stats.StoredBytes += uint64(n)
+		w.stats.StoredBlocks++
+	}
+	err = w.add(0, pointerEntry{score: score, size: uint64(n)})
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	return err
+}
+
+// store writes a block, and reports whether it was not already stored.
+// Stores other than a Jupiter are asked with Has before writing the block,
+// if they have a Hasher.
+func (w *ObjectWriter) store(t Type, b []byte) (Score, bool, error) {
+	if j, ok := w.j.(*Jupiter); ok {
+		return j.store(context.Background(), t, b)
+	}
+	stored := true
+	if x, ok := w.j.(interface{ Hasher() Hasher }); ok {
+		stored = !w.j.Has(x.Hasher().Sum(b))
+	}
+	score, err := w.j.Write(t, b)
+	return score, stored, err
+}
+
+// Stats returns the number of bytes and blocks written so far.
+func (w *ObjectWriter) Stats() ObjectStats {
+	return w.stats
+}
+
+// add appends an entry at a given depth of the tree, writing the
+// pointer block for that depth if it gets full.
+func (w *ObjectWriter) add(depth int, e pointerEntry) error {
+	if depth >= len(w.levels) {
+		if depth >= ObjectMaxDepth {
+			w.err = fmt.Errorf("jupiter: ObjectWriter: object too large: %w", ErrTooLarge)
+			return w.err
+		}
+		w.levels = append(w.levels, nil)
+	}
+	w.levels[depth] = append(w.levels[depth], e)
+	if len(w.levels[depth]) == w.fanout {
+		return w.writePointers(depth)
+	}
+	return nil
+}
+
+// writePointers stores the pending entries at a given depth as a pointer
+// block, and adds its score to the next level.
+func (w *ObjectWriter) writePointers(depth int) error {
+	var b []byte
+	var size uint64
+	for _, e := range w.levels[depth] {
+		b = appendPointerEntry(b, e)
+		size += e.size
+	}
+	w.levels[depth] = w.levels[depth][:0]
+	score, err := w.j.Write(ObjectPointerType+Type(depth), b)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	return w.add(depth+1, pointerEntry{score: score, size: size})
+}
+
+// Close writes the remaining data and pointer blocks.
+func (w *ObjectWriter) Close() error {
+	if w.closed || w.err != nil {
+		return w.err
+	}
+	for len(w.buf) > 0 || len(w.levels) == 0 {
+		n := w.chunker.Cut(w.buf)
+		if n == 0 {
+			n = len(w.buf)
+		}
+		if err := w.flush(n); err != nil {
+			return err
+		}
+	}
+	for depth := 0; depth < len(w.levels); depth++ {
+		if depth == len(w.levels)-1 && len(w.levels[depth]) == 1 {
+			w.root = w.levels[depth][0].score
+			break
+		}
+		if len(w.levels[depth]) > 0 {
+			if err := w.writePointers(depth); err != nil {
+				return err
+			}
+		}
+	}
+	w.closed = true
+	return nil
+}
+
+// Score returns the root of the tree.  It is only valid after Close.
+func (w *ObjectWriter) Score() Score {
+	return w.root
+}
+
+// A BlockReader reads blocks given their score.
+type BlockReader interface {
+	Read(score Score) (Type, []byte, error)
+}
+
+// An ObjectReader reads the contents of an object stored in a Jupiter,
+// walking the tree of pointer blocks from its root.
+type ObjectReader struct {
+	j        BlockReader
+	root     Score
+	rootType Type
+	size     int64
+	pos      int64
+}
+
+// NewObjectReader returns an ObjectReader for the object with a given root.
+func NewObjectReader(j BlockReader, root Score) (*ObjectReader, error) {
+	t, b, err := j.Read(root)
+	if err != nil {
+		return nil, err
+	}
+	r := &ObjectReader{j: j, root: root, rootType: t}
+	switch {
+	case t == ObjectDataType:
+		r.size = int64(len(b))
+	case pointerDepth(t) > 0:
+		entries, err := parsePointerBlock(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			r.size += int64(e.size)
+		}
+	default:
+		return nil, fmt.Errorf("jupiter: NewObjectReader(%s): invalid type %d", root, t)
+	}
+	return r, nil
+}
+
+// Size returns the number of bytes in the object.
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// Read reads up to len(p) bytes from the current position.
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes starting at offset off.
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("jupiter: ObjectReader.ReadAt: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && off < r.size {
+		m, err := r.readBlock(p[n:], r.root, r.rootType, uint64(off))
+		if err != nil {
+			return n, err
+		}
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlock copies data from the subtree rooted at a given block,
+// starting at offset off within that subtree.  It stops at the end
+// of the data block where off is.
+func (r *ObjectReader) readBlock(p []byte, score Score, t Type, off uint64) (int, error) {
+	tt, b, err := r.j.Read(score)
+	if err != nil {
+		return 0, err
+	}
+	if tt != t {
+		return 0, fmt.Errorf("jupiter: block %s has type %d (should be %d): %w", score, tt, t, ErrCorrupt)
+	}
+	if t == ObjectDataType {
+		if off >= uint64(len(b)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return copy(p, b[off:]), nil
+	}
+	entries, err := parsePointerBlock(b)
+	if err != nil {
+		return 0, err
+	}
+	childType := ObjectDataType
+	if depth := pointerDepth(t); depth > 1 {
+		childType = t - 1
+	}
+	for _, e := range entries {
+		if off < e.size {
+			return r.readBlock(p, e.score, childType, off)
+		}
+		off -= e.size
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+// Seek sets the offset for the next Read.
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += r.pos
+	case os.SEEK_END:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("jupiter: ObjectReader.Seek: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("jupiter: ObjectReader.Seek: negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,55 @@
+package jupiter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestObject(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	for _, size := range []int{0, 1, 1000, 10000, 100000} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+		w := NewObjectWriterSize(j, 512)
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("Write(): %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close(): %v", err)
+		}
+		r, err := NewObjectReader(j, w.Score())
+		if err != nil {
+			t.Fatalf("NewObjectReader(): %v", err)
+		}
+		if r.Size() != int64(size) {
+			t.Errorf("Size() = %d (should be %d)", r.Size(), size)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll(): %v", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("object of %d bytes: read data differs", size)
+		}
+		if size < 2 {
+			continue
+		}
+		off := int64(size / 3)
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			t.Fatalf("Seek(): %v", err)
+		}
+		b = make([]byte, size/2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatalf("ReadFull(): %v", err)
+		}
+		if !bytes.Equal(b, data[off:off+int64(len(b))]) {
+			t.Errorf("object of %d bytes: data read at %d differs", size, off)
+		}
+	}
+}
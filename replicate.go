@@ -0,0 +1,247 @@
+package jupiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReplicaBatch is the number of bytes of blocks sent to a secondary
+// before its cursor is saved
+const maxReplicaBatch = 1 << 20
+
+var errBatchFull = errors.New("batch full")
+
+// A Replica copies the blocks in the data log of a Jupiter (the primary)
+// to another store (the secondary), using the TCP protocol.  Blocks are
+// copied in the order they were written, and a cursor with the address of
+// the first block not yet copied is saved after the secondary syncs them.
+// Writing a block twice is harmless, so after a crash the blocks after the
+// last saved cursor are just sent again.
+type Replica struct {
+	Addr       string // address of the secondary
+	CursorFile string // file where the cursor is saved, or "" to keep it in memory
+
+	// Options are used to connect to the secondary; nil means plain TCP
+	// without authentication
+	Options *ClientOptions
+
+	j    *Jupiter
+	conn *Conn
+
+	mu      sync.Mutex
+	cursor  uint64
+	lag     uint64
+	blocks  uint64
+	errors  uint64
+	lastErr error
+}
+
+// NewReplica returns a Replica of a Jupiter.  The cursor is read from
+// cursorFile if it exists; otherwise, the whole data log is copied.
+func NewReplica(j *Jupiter, addr, cursorFile string) (*Replica, error) {
+	r := &Replica{Addr: addr, CursorFile: cursorFile, j: j, cursor: dataLogHeaderSize}
+	if cursorFile == "" {
+		return r, nil
+	}
+	b, err := ioutil.ReadFile(cursorFile)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cursor, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || r.cursor < dataLogHeaderSize {
+		return nil, fmt.Errorf("NewReplica(%s): invalid cursor in %s: %w", addr, cursorFile, ErrCorrupt)
+	}
+	return r, nil
+}
+
+// ReplicaCursorFile returns a name for the cursor file of the replica
+// at addr of a data log
+func ReplicaCursorFile(dataLog, addr string) string {
+	return dataLog + ".replica-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, addr)
+}
+
+// saveCursor writes the cursor to its file, replacing it atomically
+func (r *Replica) saveCursor(cursor uint64) error {
+	if r.CursorFile == "" {
+		return nil
+	}
+	tmp := r.CursorFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d\n", cursor)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, r.CursorFile)
+}
+
+// Step copies the next blocks in the data log to the secondary, up to
+// about 1MB, and returns the number of blocks copied.  Blocks are only
+// copied once the secondary has synced them; after an error, they are
+// sent again by the next Step, so none of them are counted.
+func (r *Replica) Step() (int, error) {
+	n, err := r.step()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		r.lastErr = err
+		if r.conn != nil {
+			r.conn.Close()
+			r.conn = nil
+		}
+		return 0, err
+	}
+	r.blocks += uint64(n)
+	return n, nil
+}
+
+func (r *Replica) step() (int, error) {
+	r.mu.Lock()
+	from := r.cursor
+	r.mu.Unlock()
+
+	var blocks []Block
+	var scores []Score
+	end, size := from, 0
+	r.j.mu.Lock()
+	logSize, err := r.j.datalog.Size()
+	if err == nil && logSize < from {
+		err = fmt.Errorf("replica %s: cursor %d is after the end of the data log (%d bytes): %w", r.Addr, from, logSize, ErrCorrupt)
+	}
+	if err == nil {
+		err = r.j.datalog.Walk(from, func(addr uint64, s Score, t Type, n int) error {
+			if size > 0 && size+n > maxReplicaBatch {
+				return errBatchFull
+			}
+			t, b, err := r.j.datalog.ReadChunk(s, addr)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, Block{Type: t, Data: b})
+			scores = append(scores, s)
+			end = addr + chunkHeaderSize + uint64(n)
+			size += n
+			return nil
+		})
+	}
+	r.j.mu.Unlock()
+	if err == errBatchFull || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.lag = logSize - from
+	r.mu.Unlock()
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+
+	if r.conn == nil {
+		if r.conn, err = DialWithOptions(r.Addr, r.Options); err != nil {
+			return 0, err
+		}
+	}
+	for i, b := range blocks {
+		s, err := r.conn.Write(b.Type, b.Data)
+		if err != nil {
+			return 0, err
+		}
+		if !s.Equal(scores[i]) {
+			return 0, fmt.Errorf("replica %s: block %s stored with score %s", r.Addr, scores[i], s)
+		}
+	}
+	if err := r.conn.Sync(); err != nil {
+		return 0, err
+	}
+	if err := r.saveCursor(end); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.cursor = end
+	r.lag = logSize - end
+	r.mu.Unlock()
+	return len(blocks), nil
+}
+
+// Run copies the blocks to the secondary until the context is done.
+// When there are no more blocks, or after an error, it waits for the given
+// interval before trying again.
+func (r *Replica) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		n, err := r.Step()
+		if err != nil {
+			r.j.logger().Log(LevelWarn, "replication failed", Field{"replica", r.Addr}, Field{"error", err})
+		}
+		if n == 0 || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Close closes the connection to the secondary.  It must not be called
+// while Step or Run are running.
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// ReplicaMetrics has the state of a Replica.  LagBytes is the size of the
+// blocks not yet copied, as seen in the last Step.
+type ReplicaMetrics struct {
+	Cursor    uint64 `json:"cursor"`
+	LagBytes  uint64 `json:"lag_bytes"`
+	Blocks    uint64 `json:"blocks"`
+	Errors    uint64 `json:"errors"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Metrics returns the current state of a Replica
+func (r *Replica) Metrics() ReplicaMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := ReplicaMetrics{Cursor: r.cursor, LagBytes: r.lag, Blocks: r.blocks, Errors: r.errors}
+	if r.lastErr != nil {
+		m.LastError = r.lastErr.Error()
+	}
+	return m
+}
@@ -0,0 +1,113 @@
+package jupiter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplica(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	primary, _ := New()
+	secondary, _ := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(secondary)
+	go srv.Serve(l)
+	defer srv.Shutdown(context.Background())
+
+	cursor := filepath.Join(dir, "cursor")
+	r, err := NewReplica(primary, l.Addr().String(), cursor)
+	if err != nil {
+		t.Fatalf("NewReplica(): %v", err)
+	}
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			// blocks of 1000 bytes, so that several steps are needed
+			primary.Write(1, bytes.Repeat([]byte(fmt.Sprintf("%8d", i)), 125))
+		}
+	}
+	write(0, 2000)
+	total := 0
+	for {
+		n, err := r.Step()
+		if err != nil {
+			t.Fatalf("Step(): %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+	}
+	m := r.Metrics()
+	if total != 2000 || m.Blocks != 2000 || m.LagBytes != 0 || secondary.Metrics().Blocks != 2000 {
+		t.Errorf("after replication: %d blocks copied, metrics %+v, secondary has %d blocks", total, m, secondary.Metrics().Blocks)
+	}
+	r.Close()
+
+	// a new Replica continues from the saved cursor
+	write(2000, 2100)
+	r, err = NewReplica(primary, l.Addr().String(), cursor)
+	if err != nil {
+		t.Fatalf("NewReplica(): %v", err)
+	}
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx, 10*time.Millisecond) }()
+	for i := 0; i < 100 && r.Metrics().Blocks < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if m := r.Metrics(); m.Blocks != 100 || secondary.Metrics().Blocks != 2100 {
+		t.Errorf("after Run(): metrics %+v, secondary has %d blocks", m, secondary.Metrics().Blocks)
+	}
+
+	// the lag is reported to the StatsHandler
+	h := NewStatsHandler(primary)
+	h.AddReplica(r)
+	if m, ok := h.Metrics().Replicas[r.Addr]; !ok || m.Cursor == 0 {
+		t.Errorf("StatsHandler.Metrics(): replica metrics %+v", m)
+	}
+}
+
+func TestReplicaError(t *testing.T) {
+	primary, _ := New()
+	secondary, _ := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(secondary)
+	go srv.Serve(l)
+	defer srv.Shutdown(context.Background())
+
+	// the secondary rejects the second block, after storing the first one
+	primary.Write(1, []byte("first"))
+	primary.Write(1, []byte("second"))
+	secondary.Write(2, []byte("second"))
+	r, err := NewReplica(primary, l.Addr().String(), "")
+	if err != nil {
+		t.Fatalf("NewReplica(): %v", err)
+	}
+	defer r.Close()
+	if n, err := r.Step(); err == nil || n != 0 {
+		t.Errorf("Step() = %d, %v", n, err)
+	}
+	if m := r.Metrics(); m.Blocks != 0 || m.Errors != 1 {
+		t.Errorf("after a failed Step(): metrics %+v", m)
+	}
+}
@@ -2,8 +2,10 @@ package jupiter
 
 import (
 	"bytes"
-	"crypto/sha512"
+	"database/sql/driver"
+	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -16,12 +18,108 @@ type Score struct {
 
 var ZeroScore = Score{}
 
+// GetScore returns the score of a block using the default hash, SHA-512/256
 func GetScore(b []byte) Score {
+	return SHA512_256.Sum(b)
+}
+
+// ScoreFromBytes returns the Score with a given value
+func ScoreFromBytes(b []byte) (Score, error) {
 	var s Score
-	h := sha512.New512_256()
-	h.Write(b)
-	copy(s.s[:], h.Sum(nil))
-	return s
+	if len(b) != ScoreSize {
+		return s, fmt.Errorf("ScoreFromBytes(): got %d bytes (should be %d)", len(b), ScoreSize)
+	}
+	copy(s.s[:], b)
+	return s, nil
+}
+
+// Bytes returns the value of a Score
+func (s Score) Bytes() []byte {
+	return append([]byte(nil), s.s[:]...)
+}
+
+// ParseScore reads a score written in hexadecimal, as returned by String,
+// or tagged with the name of its hash algorithm, as returned by TagScore
+func ParseScore(s string) (Score, error) {
+	var score Score
+	if strings.IndexByte(s, ':') >= 0 {
+		_, score, err := ParseTaggedScore(s)
+		return score, err
+	}
+	if len(s) != 2*ScoreSize {
+		return score, fmt.Errorf("ParseScore(%q): length is %d (should be %d)", s, len(s), 2*ScoreSize)
+	}
+	if _, err := hex.Decode(score.s[:], []byte(s)); err != nil {
+		return ZeroScore, fmt.Errorf("ParseScore(%q): %v", s, err)
+	}
+	return score, nil
+}
+
+// parseScorePrefix reads the first hexadecimal digits of a score,
+// and returns the score padded with zeros and the number of bits given.
+func parseScorePrefix(s string) (Score, int, error) {
+	var score Score
+	if len(s) == 0 || len(s) > 2*ScoreSize {
+		return score, 0, fmt.Errorf("invalid score prefix %q", s)
+	}
+	padded := s
+	if len(padded)%2 == 1 {
+		padded += "0"
+	}
+	if _, err := hex.Decode(score.s[:], []byte(padded)); err != nil {
+		return ZeroScore, 0, fmt.Errorf("invalid score prefix %q: %v", s, err)
+	}
+	return score, 4 * len(s), nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Score) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *Score) UnmarshalText(b []byte) error {
+	score, err := ParseScore(string(b))
+	if err != nil {
+		return err
+	}
+	*s = score
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (s Score) MarshalBinary() ([]byte, error) {
+	return s.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (s *Score) UnmarshalBinary(b []byte) error {
+	score, err := ScoreFromBytes(b)
+	if err != nil {
+		return err
+	}
+	*s = score
+	return nil
+}
+
+// Value implements driver.Valuer.  Scores are stored as 32-byte blobs.
+func (s Score) Value() (driver.Value, error) {
+	return s.Bytes(), nil
+}
+
+// Scan implements sql.Scanner.  It accepts the value of a score as
+// 32 bytes, or written in hexadecimal.
+func (s *Score) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == ScoreSize {
+			return s.UnmarshalBinary(v)
+		}
+		return s.UnmarshalText(v)
+	case string:
+		return s.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("Score.Scan(): cannot convert %T to a score", src)
 }
 
 func isBitEqual(b1 []byte, b2 []byte, n int) bool {
@@ -39,6 +137,12 @@ func (s Score) String() string {
 	return fmt.Sprintf("%0x", s.s[:])
 }
 
+// Prefix returns the first bits of a score in hexadecimal,
+// rounded up to a whole number of digits
+func (s Score) Prefix(bits int) string {
+	return hex.EncodeToString(s.s[:(bits+7)/8])[:(bits+3)/4]
+}
+
 func (s Score) Match(s2 Score, mask int) bool {
 	for i := 0; i < mask; i++ {
 		if !isBitEqual(s.s[:], s2.s[:], i) {
@@ -1,6 +1,9 @@
 package jupiter
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -22,3 +25,87 @@ func TestScore(t *testing.T) {
 		t.Errorf(`Score(Score("")) is %s (should be a8dfa748...)`, s)
 	}
 }
+
+func TestScoreEncoding(t *testing.T) {
+	s := GetScore([]byte("hello"))
+	s2, err := ParseScore(s.String())
+	if err != nil || !s2.Equal(s) {
+		t.Errorf("ParseScore(%s) = %s, %v", s, s2, err)
+	}
+	for _, bad := range []string{"", "c672", s.String() + "00", "x" + s.String()[1:]} {
+		if _, err := ParseScore(bad); err == nil {
+			t.Errorf("ParseScore(%q) should fail", bad)
+		}
+	}
+
+	b, err := json.Marshal(map[string]Score{"root": s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"root":"`+s.String()+`"}` {
+		t.Errorf("json.Marshal() = %s", b)
+	}
+	var m map[string]Score
+	if err := json.Unmarshal(b, &m); err != nil || !m["root"].Equal(s) {
+		t.Errorf("json.Unmarshal(%s) = %v, %v", b, m, err)
+	}
+
+	b, _ = s.MarshalBinary()
+	var s3 Score
+	if err := s3.UnmarshalBinary(b); err != nil || !s3.Equal(s) {
+		t.Errorf("UnmarshalBinary() = %s, %v", s3, err)
+	}
+
+	v, _ := s.Value()
+	for _, src := range []interface{}{v, s.String(), []byte(s.String())} {
+		var s4 Score
+		if err := s4.Scan(src); err != nil || !s4.Equal(s) {
+			t.Errorf("Scan(%T) = %s, %v", src, s4, err)
+		}
+	}
+	if err := s3.Scan(42); err == nil {
+		t.Errorf("Scan(42) should fail")
+	}
+}
+
+func TestResolveScore(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scores []Score
+	for i := 0; i < 1000; i++ {
+		s, err := j.Write(1, []byte(fmt.Sprintf("block %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scores = append(scores, s)
+	}
+	for _, s := range scores[:20] {
+		r, err := j.ResolveScore(s.String()[:12])
+		if err != nil || !r.Equal(s) {
+			t.Errorf("ResolveScore(%s) = %s, %v", s.String()[:12], r, err)
+		}
+		r, err = j.ResolveScore(s.String()[:11])
+		if err != nil || !r.Equal(s) {
+			t.Errorf("ResolveScore(%s) = %s, %v", s.String()[:11], r, err)
+		}
+	}
+	tagged := TagScore(j.Hasher(), scores[0])
+	if r, err := j.ResolveScore(tagged[:len("sha512-256:")+12]); err != nil || !r.Equal(scores[0]) {
+		t.Errorf("ResolveScore(%s) = %s, %v", tagged[:len("sha512-256:")+12], r, err)
+	}
+	if _, err := j.ResolveScore("sha1:" + scores[0].String()[:12]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ResolveScore() with another hash algorithm: %v, want ErrNotFound", err)
+	}
+	if _, err := j.ResolveScore(scores[0].String()[:1]); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("ResolveScore(%s): %v, want ErrAmbiguous", scores[0].String()[:1], err)
+	}
+	missing := GetScore([]byte("missing"))
+	if _, err := j.ResolveScore(missing.String()[:12]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ResolveScore(missing): %v, want ErrNotFound", err)
+	}
+	if _, err := j.ResolveScore("xyz"); err == nil {
+		t.Errorf("ResolveScore(xyz) should fail")
+	}
+}
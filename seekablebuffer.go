@@ -120,7 +120,7 @@ func (sb *seekableBuffer) Seek(offset int64, whence int) (n int64, err error) {
 	} else if whence == os.SEEK_CUR {
 		sb.position += offset
 	} else {
-		panic(fmt.Sprintf("seek whence is not valid: (%d)", whence))
+		return 0, fmt.Errorf("seek whence is not valid: (%d)", whence)
 	}
 
 	if sb.position < 0 {
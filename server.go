@@ -0,0 +1,691 @@
+package jupiter
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The TCP protocol is a sequence of requests, each one answered by a response
+// before the next one is sent.  Every message is prefixed by its length,
+// as a big-endian 32-bit unsigned int.
+//
+// Requests start with an operation:
+//
+//	'R' score            read a block
+//	'W' type data        write a block
+//	'S' score            get the type and size of a block
+//	'Y'                  sync the store
+//	'A' token            authenticate with a pre-shared token
+//
+// A request can be prefixed by 'T' and a timeout in milliseconds (4 bytes):
+// the server gives up on it when the timeout expires, and answers with
+// the status for timeouts.  Conn sends it when its context has a deadline.
+//
+// Responses start with a status: 0 if the request was successful,
+// followed by the result:
+//
+//	R: type data
+//	W: score
+//	S: type size (4 bytes)
+//	Y: nothing
+//	A: nothing
+//
+// or an error code followed by a message.
+//
+// Connections can use TLS.  The permissions of a client (see Auth) are
+// those of the identity of its token, if it sent one, or else of the
+// common name of its certificate.  The server can limit the bytes of new
+// blocks written by each identity, and its requests per second (see Limits).
+const (
+	opRead  = 'R'
+	opWrite = 'W'
+	opStat  = 'S'
+	opSync  = 'Y'
+	opAuth  = 'A'
+
+	opDeadline = 'T'
+
+	statusOK           = 0
+	statusNotFound     = 1
+	statusTypeMismatch = 2
+	statusTooLarge     = 3
+	statusCorrupt      = 4
+	statusTimeout      = 5
+	statusDenied       = 6
+	statusQuota        = 7
+	statusRateLimited  = 8
+	statusFailed       = 255
+
+	// a write request with a deadline: deadline, op, type and block
+	maxMessageSize = 5 + 2 + MaxChunkSize
+)
+
+// ErrServerClosed is returned by Server.Serve after a call to Shutdown
+var ErrServerClosed = errors.New("jupiter: server closed")
+
+// writeMessage sends a message prefixed by its length
+func writeMessage(w io.Writer, parts ...[]byte) error {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	b := make([]byte, 4, 4+n)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readMessage receives a message prefixed by its length
+func readMessage(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > maxMessageSize {
+		return nil, fmt.Errorf("jupiter: invalid message size %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// errorStatus returns the status code for an error
+func errorStatus(err error) byte {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return statusNotFound
+	case errors.Is(err, ErrTypeMismatch):
+		return statusTypeMismatch
+	case errors.Is(err, ErrTooLarge):
+		return statusTooLarge
+	case errors.Is(err, ErrCorrupt):
+		return statusCorrupt
+	case errors.Is(err, context.DeadlineExceeded):
+		return statusTimeout
+	case errors.Is(err, ErrPermission):
+		return statusDenied
+	case errors.Is(err, ErrQuotaExceeded):
+		return statusQuota
+	case errors.Is(err, ErrRateLimited):
+		return statusRateLimited
+	}
+	return statusFailed
+}
+
+// A remoteError is an error returned by a Server.  It has the message
+// sent by the server, and the sentinel error for its status, if any.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+func (e *remoteError) Unwrap() error { return e.err }
+
+// statusErr returns the error for a status code and message
+func statusErr(status byte, msg string) error {
+	e := &remoteError{msg: msg}
+	switch status {
+	case statusNotFound:
+		e.err = ErrNotFound
+	case statusTypeMismatch:
+		e.err = ErrTypeMismatch
+	case statusTooLarge:
+		e.err = ErrTooLarge
+	case statusCorrupt:
+		e.err = ErrCorrupt
+	case statusTimeout:
+		e.err = context.DeadlineExceeded
+	case statusDenied:
+		e.err = ErrPermission
+	case statusQuota:
+		e.err = ErrQuotaExceeded
+	case statusRateLimited:
+		e.err = ErrRateLimited
+	}
+	return e
+}
+
+// A Server serves the blocks of a Jupiter using the TCP protocol.
+// It uses TLS if the listener given to Serve does.
+type Server struct {
+	j *Jupiter
+
+	// Auth has the clients allowed to use the Server; nil allows everyone
+	// to read and write.  It must be set before calling Serve.
+	Auth *Auth
+
+	// Limits has the quotas and rate limits of the clients; nil means
+	// no limits.  It must be set before calling Serve.
+	Limits *Limits
+
+	usage usageMap
+
+	// ctx is canceled when Shutdown stops waiting for the requests in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]int // number of requests in progress; 0 if the connection is idle
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a Server for a Jupiter
+func NewServer(j *Jupiter) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		j:         j,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]int),
+	}
+}
+
+// Serve accepts connections on a listener, and serves each one in
+// a new goroutine.  It always returns an error; after Shutdown,
+// it is ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			continue
+		}
+		s.conns[c] = 0
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+// startRequest records that a request is being read from a connection
+func (s *Server) startRequest(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c]++
+	// Shutdown may have set a deadline just before the request arrived
+	c.SetReadDeadline(time.Time{})
+}
+
+// endRequest records that the response to a request has been written.
+// It returns false if the connection is left idle and it should be closed
+// because the server is shutting down.
+func (s *Server) endRequest(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c]--
+	return s.conns[c] > 0 || !s.closed
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	// The requests are read in another goroutine, which is always reading
+	// from the connection: if the connection fails (because the client
+	// went away), ctx is canceled, and so are the requests in progress.
+	// When the client just stops sending requests (or it sends an invalid
+	// one), the ones already read are answered before closing.
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	reqs := make(chan []byte)
+	go func() {
+		defer close(reqs)
+		r := bufio.NewReader(c)
+		for {
+			if _, err := r.Peek(1); err != nil {
+				if _, ok := err.(net.Error); ok {
+					cancel()
+				}
+				return
+			}
+			s.startRequest(c)
+			req, err := readMessage(r)
+			if _, ok := err.(net.Error); ok {
+				cancel()
+				return
+			}
+			if err != nil {
+				s.j.logger().Log(LevelDebug, "bad request", Field{"remote", c.RemoteAddr()}, Field{"error", err})
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var ss session
+	for req := range reqs {
+		// the TLS handshake is done by the first read
+		if tc, ok := c.(*tls.Conn); ok && !ss.tls {
+			state := tc.ConnectionState()
+			ss.identity, ss.tls = tlsIdentity(&state), true
+		}
+		var resp [][]byte
+		if result, err := s.handle(ctx, &ss, req); err != nil {
+			resp = [][]byte{{errorStatus(err)}, []byte(err.Error())}
+		} else {
+			resp = append([][]byte{{statusOK}}, result...)
+		}
+		if err := writeMessage(c, resp...); err != nil || !s.endRequest(c) || ss.denied {
+			return
+		}
+	}
+}
+
+// A session has the identity of the client of a connection
+type session struct {
+	identity string
+	tls      bool // the identity of the TLS certificate has been read
+	denied   bool // the client sent an invalid token
+}
+
+// HTTPHandler is like s.Auth.HTTPHandler, but the requests with an
+// invalid token also count for the rate limit of their clients in s.
+func (s *Server) HTTPHandler(h http.Handler) http.Handler {
+	return s.Auth.httpHandler(h, s.allow)
+}
+
+// handle runs a request, and returns the parts of the response
+func (s *Server) handle(ctx context.Context, ss *session, req []byte) ([][]byte, error) {
+	if req[0] == opDeadline {
+		if len(req) < 6 {
+			return nil, errors.New("jupiter: invalid deadline in request")
+		}
+		timeout := time.Duration(binary.BigEndian.Uint32(req[1:])) * time.Millisecond
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req = req[5:]
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("jupiter: %w", err)
+	}
+	op, args := req[0], req[1:]
+	if op == opAuth {
+		identity, ok := s.Auth.Identify(string(args))
+		if !ok {
+			// a failed attempt counts for the rate limit of the client
+			// as it was, and the connection is closed after it
+			ss.denied = true
+			if err := s.allow(ss.identity); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("jupiter: invalid token: %w", ErrPermission)
+		}
+		ss.identity = identity
+		return nil, nil
+	}
+	need := PermRead
+	if op == opWrite || op == opSync {
+		need = PermWrite
+	}
+	if s.Auth.Permission(ss.identity) < need {
+		return nil, fmt.Errorf("jupiter: %s permission needed: %w", need, ErrPermission)
+	}
+	if err := s.allow(ss.identity); err != nil {
+		return nil, err
+	}
+	switch op {
+	case opRead, opStat:
+		score, err := ScoreFromBytes(args)
+		if err != nil {
+			return nil, err
+		}
+		if op == opStat {
+			t, size, err := s.j.Stat(score)
+			if err != nil {
+				return nil, err
+			}
+			var b [5]byte
+			b[0] = byte(t)
+			binary.BigEndian.PutUint32(b[1:], uint32(size))
+			return [][]byte{b[:]}, nil
+		}
+		t, b, err := s.j.ReadContext(ctx, score)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{{byte(t)}, b}, nil
+	case opWrite:
+		if len(args) < 1 {
+			return nil, errors.New("jupiter: write request without type")
+		}
+		score, err := s.write(ctx, ss.identity, Type(args[0]), args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{score.s[:]}, nil
+	case opSync:
+		return nil, s.j.SyncContext(ctx)
+	}
+	return nil, fmt.Errorf("jupiter: unknown operation %q", op)
+}
+
+// allow counts a request of a client, and checks its rate limit
+func (s *Server) allow(identity string) error {
+	rate, limited := s.Limits.rate(identity)
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	u := s.usage.client(identity)
+	u.Requests++
+	if limited && !u.allow(rate, time.Now()) {
+		u.RateDenied++
+		return fmt.Errorf("jupiter: more than %g requests per second: %w", rate, ErrRateLimited)
+	}
+	return nil
+}
+
+// write stores a block written by a client, checking its quota.
+// Blocks which are already stored do not count for the quota.
+func (s *Server) write(ctx context.Context, identity string, t Type, b []byte) (Score, error) {
+	quota, limited := s.Limits.quota(identity)
+	n := uint64(len(b))
+	s.usage.mu.Lock()
+	u := s.usage.client(identity)
+	over := limited && u.WrittenBytes+u.pending+n > quota
+	if !over {
+		u.pending += n
+	}
+	s.usage.mu.Unlock()
+	if over && !s.j.Has(s.j.Hasher().Sum(b)) {
+		s.usage.mu.Lock()
+		u.QuotaDenied++
+		s.usage.mu.Unlock()
+		return ZeroScore, fmt.Errorf("jupiter: quota of %d bytes exceeded: %w", quota, ErrQuotaExceeded)
+	}
+	score, isNew, err := s.j.store(ctx, t, b)
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	if !over {
+		u.pending -= n
+	}
+	if isNew {
+		u.WrittenBytes += n
+		u.Blocks++
+	}
+	return score, err
+}
+
+// Usage returns the usage of the Server by each identity since it
+// started.  Clients which are not authenticated are under AnyIdentity.
+func (s *Server) Usage() map[string]ClientMetrics {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	m := make(map[string]ClientMetrics, len(s.usage.clients))
+	for identity, u := range s.usage.clients {
+		c := u.ClientMetrics
+		c.QuotaBytes, _ = s.Limits.quota(identity)
+		m[identity] = c
+	}
+	return m
+}
+
+// Shutdown stops the server: it closes the listeners and the idle
+// connections, and waits for the requests in progress to finish.
+// If the context expires first, the requests in progress are canceled,
+// the remaining connections are closed and the error of the context
+// is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c, n := range s.conns {
+		if n == 0 {
+			c.SetReadDeadline(time.Now())
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// A Conn is a connection to a Server.  It is safe for concurrent use,
+// but requests are sent one at a time.
+//
+// The methods with a context send the deadline of the context, if any,
+// to the server, and give up when the context is done.  A request that
+// is given up may leave its response unread, so the connection cannot be
+// used after that.
+type Conn struct {
+	mu  sync.Mutex
+	c   net.Conn
+	r   *bufio.Reader
+	err error // set when the connection cannot be used anymore
+}
+
+// Dial connects to the Server at a given address
+func Dial(addr string) (*Conn, error) {
+	return DialWithOptions(addr, nil)
+}
+
+// DialWithOptions connects to the Server at a given address, using TLS
+// and authenticating with a token if the options say so
+func DialWithOptions(addr string, o *ClientOptions) (*Conn, error) {
+	if o == nil {
+		o = &ClientOptions{}
+	}
+	var c net.Conn
+	var err error
+	if o.TLS != nil {
+		c, err = tls.Dial("tcp", addr, o.TLS)
+	} else {
+		c, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &Conn{c: c, r: bufio.NewReader(c)}
+	if o.Token != "" {
+		if _, err := conn.call(context.Background(), "Auth", []byte{opAuth}, []byte(o.Token)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// call sends a request and returns the result in its response
+func (c *Conn) call(ctx context.Context, name string, req ...[]byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("jupiter: Conn.%s: %w", name, err)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		timeout := time.Until(d) / time.Millisecond
+		if timeout <= 0 {
+			return nil, fmt.Errorf("jupiter: Conn.%s: %w", name, context.DeadlineExceeded)
+		}
+		if timeout > math.MaxUint32 {
+			timeout = math.MaxUint32
+		}
+		var b [5]byte
+		b[0] = opDeadline
+		binary.BigEndian.PutUint32(b[1:], uint32(timeout))
+		req = append([][]byte{b[:]}, req...)
+		c.c.SetDeadline(d)
+		defer c.c.SetDeadline(time.Time{})
+	}
+	if ctx.Done() != nil {
+		stop, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(done)
+			select {
+			case <-ctx.Done():
+				// unblock the reads and writes in progress
+				c.c.SetDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.err = fmt.Errorf("jupiter: Conn.%s: %w", name, err)
+		c.c.Close()
+		return nil, c.err
+	}
+	if resp[0] != statusOK {
+		return nil, statusErr(resp[0], fmt.Sprintf("jupiter: Conn.%s: %s", name, resp[1:]))
+	}
+	return resp[1:], nil
+}
+
+// roundTrip sends a request and reads its response
+func (c *Conn) roundTrip(req [][]byte) ([]byte, error) {
+	if err := writeMessage(c.c, req...); err != nil {
+		return nil, err
+	}
+	return readMessage(c.r)
+}
+
+// Read returns the type and contents of a block
+func (c *Conn) Read(score Score) (Type, []byte, error) {
+	return c.ReadContext(context.Background(), score)
+}
+
+// ReadContext is like Read, with a context for the request
+func (c *Conn) ReadContext(ctx context.Context, score Score) (Type, []byte, error) {
+	b, err := c.call(ctx, "Read", []byte{opRead}, score.s[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 1 {
+		return 0, nil, errors.New("jupiter: Conn.Read: short response")
+	}
+	return Type(b[0]), b[1:], nil
+}
+
+// Write stores a block and returns its score
+func (c *Conn) Write(t Type, b []byte) (Score, error) {
+	return c.WriteContext(context.Background(), t, b)
+}
+
+// WriteContext is like Write, with a context for the request
+func (c *Conn) WriteContext(ctx context.Context, t Type, b []byte) (Score, error) {
+	if len(b) > MaxChunkSize {
+		return ZeroScore, fmt.Errorf("jupiter: Conn.Write: %d bytes: %w", len(b), ErrTooLarge)
+	}
+	resp, err := c.call(ctx, "Write", []byte{opWrite, byte(t)}, b)
+	if err != nil {
+		return ZeroScore, err
+	}
+	return ScoreFromBytes(resp)
+}
+
+// Stat returns the type and size of a block
+func (c *Conn) Stat(score Score) (Type, int, error) {
+	return c.StatContext(context.Background(), score)
+}
+
+// StatContext is like Stat, with a context for the request
+func (c *Conn) StatContext(ctx context.Context, score Score) (Type, int, error) {
+	b, err := c.call(ctx, "Stat", []byte{opStat}, score.s[:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(b) != 5 {
+		return 0, 0, errors.New("jupiter: Conn.Stat: invalid response")
+	}
+	return Type(b[0]), int(binary.BigEndian.Uint32(b[1:])), nil
+}
+
+// Has reports whether a block is stored.  Errors are reported as missing blocks.
+func (c *Conn) Has(score Score) bool {
+	_, _, err := c.Stat(score)
+	return err == nil
+}
+
+// Sync asks the server to commit its contents to stable storage
+func (c *Conn) Sync() error {
+	return c.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, with a context for the request
+func (c *Conn) SyncContext(ctx context.Context) error {
+	_, err := c.call(ctx, "Sync", []byte{opSync})
+	return err
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,219 @@
+package jupiter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(j)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	defer c.Close()
+
+	s, err := c.Write(3, []byte("hello"))
+	if err != nil || !s.Equal(GetScore([]byte("hello"))) {
+		t.Fatalf("Write() = %s, %v", s, err)
+	}
+	typ, b, err := c.Read(s)
+	if err != nil || typ != 3 || string(b) != "hello" {
+		t.Errorf("Read() = %d, %q, %v", typ, b, err)
+	}
+	typ, size, err := c.Stat(s)
+	if err != nil || typ != 3 || size != 5 {
+		t.Errorf("Stat() = %d, %d, %v", typ, size, err)
+	}
+	if !c.Has(s) || c.Has(ZeroScore) {
+		t.Errorf("Has() is wrong")
+	}
+	if err := c.Sync(); err != nil {
+		t.Errorf("Sync(): %v", err)
+	}
+	if _, b, err := c.Read(GetScore(nil)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read(missing) = %q, %v, want ErrNotFound", b, err)
+	}
+	if _, err := c.Write(4, []byte("hello")); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Write() with another type: %v, want ErrTypeMismatch", err)
+	}
+	if _, err := c.Write(0, nil); err != nil {
+		t.Errorf("Write() of an empty block: %v", err)
+	}
+
+	// Shutdown closes idle connections and stops Serve
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown(): %v", err)
+	}
+	if err := <-errc; err != ErrServerClosed {
+		t.Errorf("Serve() = %v, want ErrServerClosed", err)
+	}
+	if _, _, err := c.Read(s); err == nil {
+		t.Errorf("Read() after Shutdown should fail")
+	}
+}
+
+func TestServerContext(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewServer(j).Serve(l)
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := c.WriteContext(ctx, 3, []byte("hello"))
+	if err != nil {
+		t.Fatalf("WriteContext() with a deadline: %v", err)
+	}
+	if typ, b, err := c.ReadContext(ctx, s); err != nil || typ != 3 || string(b) != "hello" {
+		t.Errorf("ReadContext() = %d, %q, %v", typ, b, err)
+	}
+	if err := c.SyncContext(ctx); err != nil {
+		t.Errorf("SyncContext(): %v", err)
+	}
+	big := make([]byte, MaxChunkSize)
+	if s, err := c.WriteContext(ctx, 4, big); err != nil || !s.Equal(GetScore(big)) {
+		t.Errorf("WriteContext() of a block of %d bytes with a deadline: %s, %v", len(big), s, err)
+	}
+
+	// the server gives up on a request whose deadline has passed
+	_, err = c.call(context.Background(), "Read", []byte{opDeadline, 0, 0, 0, 0, opRead}, s.s[:])
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request with an expired deadline: %v, want DeadlineExceeded", err)
+	}
+
+	// a request canceled before being sent leaves the connection usable
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.ReadContext(ctx, s); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext() with a canceled context: %v", err)
+	}
+	if _, _, err := c.Read(s); err != nil {
+		t.Errorf("Read() after a request canceled before being sent: %v", err)
+	}
+}
+
+func TestServerDisconnect(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(j)
+	go srv.Serve(l)
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a client which stops sending requests gets the responses to the
+	// ones it has sent
+	if err := writeMessage(c, []byte{opWrite, 1}, []byte("half-closed")); err != nil {
+		t.Fatal(err)
+	}
+	c.(*net.TCPConn).CloseWrite()
+	resp, err := readMessage(c)
+	if err != nil || resp[0] != statusOK || !j.Has(GetScore([]byte("half-closed"))) {
+		t.Errorf("request of a half-closed connection: %v, %v", resp, err)
+	}
+	c.Close()
+
+	// the write waits for the lock, and the client goes away meanwhile
+	c, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.mu.Lock()
+	if err := writeMessage(c, []byte{opWrite, 1}, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.(*net.TCPConn).SetLinger(0) // the connection is reset
+	c.Close()
+	time.Sleep(50 * time.Millisecond)
+	j.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown(): %v", err)
+	}
+	if j.Has(GetScore([]byte("hello"))) {
+		t.Errorf("the request of a client which disconnected was not canceled")
+	}
+}
+
+func TestServerPipeline(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(j)
+	go srv.Serve(l)
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// two requests are sent before the first one is answered, and the
+	// server is shut down meanwhile: both are answered
+	j.mu.Lock()
+	for _, b := range []string{"first", "second"} {
+		if err := writeMessage(c, []byte{opWrite, 1}, []byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- srv.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	j.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		if resp, err := readMessage(c); err != nil || resp[0] != statusOK {
+			t.Errorf("response %d: %v, %v", i, resp, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown(): %v", err)
+	}
+}
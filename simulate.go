@@ -0,0 +1,115 @@
+package jupiter
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// A Simulation fills an index with random scores, without a data log,
+// to see how it would behave with a given configuration.
+type Simulation struct {
+	Blocks         int   // number of scores added to the index
+	Lookups        int   // number of missing scores looked up
+	BucketSize     int   // size of the buckets; only BlockSize is supported
+	FPSize         int   // bytes of the score stored in each entry
+	InitialBuckets int   // number of buckets in the new index
+	AddressBytes   int   // bytes used for the address of each block
+	Seed           int64 // seed for the random scores
+}
+
+// SimulationResult has the state of the index after a Simulation
+type SimulationResult struct {
+	Buckets      uint32
+	BinHeapDepth int
+	BucketFill   []uint64 // number of buckets with 0-10%, 10-20%... of entries used
+	MinFill      float64  // fraction of entries used in the emptiest bucket
+	MeanFill     float64
+	MaxFill      float64
+	IndexBytes   uint64 // size of the index file
+	BinHeapBytes uint64 // size of the BinHeap file
+
+	// Lookups of missing scores, how many of them found some entries
+	// with the same partial score, and the number of those entries.
+	// Each entry would need a read from the data log to discard it.
+	Lookups        int
+	FalsePositives int
+	Candidates     int
+}
+
+// FalsePositiveRate returns the fraction of lookups of missing scores
+// that would need to read the data log
+func (r *SimulationResult) FalsePositiveRate() float64 {
+	if r.Lookups == 0 {
+		return 0
+	}
+	return float64(r.FalsePositives) / float64(r.Lookups)
+}
+
+// Run adds the random scores to an empty index and looks up the missing ones
+func (s *Simulation) Run() (*SimulationResult, error) {
+	c := &Config{BucketSize: s.BucketSize, FPSize: s.FPSize, InitialBuckets: s.InitialBuckets}
+	if c.BucketSize != BlockSize {
+		return nil, fmt.Errorf("bucketsize must be %d", BlockSize)
+	}
+	if s.AddressBytes < 1 || s.AddressBytes > 8 {
+		return nil, fmt.Errorf("address bytes must be between 1 and 8")
+	}
+	if err := c.checkIndex(); err != nil {
+		return nil, err
+	}
+	j, err := newJupiter(c.FPSize, log2(c.InitialBuckets))
+	if err != nil {
+		return nil, err
+	}
+
+	// every address has its highest byte set, so it needs AddressBytes bytes
+	high := uint64(1) << uint(8*s.AddressBytes-1)
+	mask := high | (high - 1)
+	rnd := rand.New(rand.NewSource(s.Seed))
+	var score Score
+	for i := 0; i < s.Blocks; i++ {
+		rnd.Read(score.s[:])
+		if err := j.addToIndex(score, rnd.Uint64()&mask|high); err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+
+	r := &SimulationResult{
+		Buckets:      j.index.NumBuckets(),
+		BinHeapDepth: j.binheap.Depth(),
+		BucketFill:   make([]uint64, numFillBins),
+		MinFill:      1,
+		Lookups:      s.Lookups,
+		IndexBytes:   uint64(j.index.NumBuckets()) * BlockSize,
+		BinHeapBytes: binHeapHeaderSize + 4*uint64(len(j.binheap.table)),
+	}
+	for n := uint32(0); n < r.Buckets; n++ {
+		b, err := j.index.Bucket(n)
+		if err != nil {
+			return nil, err
+		}
+		fill := float64(b.NumEntries()) / float64(b.MaxEntries())
+		if fill < r.MinFill {
+			r.MinFill = fill
+		}
+		if fill > r.MaxFill {
+			r.MaxFill = fill
+		}
+		r.MeanFill += fill / float64(r.Buckets)
+		r.BucketFill[fillBin(b)]++
+	}
+
+	// the scores are random, so they are not in the index
+	for i := 0; i < s.Lookups; i++ {
+		rnd.Read(score.s[:])
+		addrs, err := j.lookup(score)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) > 0 {
+			r.FalsePositives++
+			r.Candidates += len(addrs)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,31 @@
+package jupiter
+
+import "testing"
+
+func TestSimulation(t *testing.T) {
+	s := Simulation{Blocks: 5000, Lookups: 5000, BucketSize: BlockSize, FPSize: ScoreBytesInEntry, InitialBuckets: 4, AddressBytes: 5}
+	r, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	var buckets uint64
+	for _, n := range r.BucketFill {
+		buckets += n
+	}
+	if r.Buckets < 4 || buckets != uint64(r.Buckets) || r.MinFill > r.MeanFill || r.MeanFill > r.MaxFill {
+		t.Errorf("Run() = %+v", r)
+	}
+	if r.IndexBytes != uint64(r.Buckets)*BlockSize || r.FalsePositives != 0 {
+		t.Errorf("Run() = %+v", r)
+	}
+
+	// with 2 bytes per score, many missing scores match some entry
+	s.FPSize = 2
+	if r, err = s.Run(); err != nil || r.FalsePositiveRate() == 0 {
+		t.Errorf("Run() with fpsize 2 = %+v, %v", r, err)
+	}
+	s.BucketSize = 4096
+	if _, err := s.Run(); err == nil {
+		t.Errorf("Run() with an unsupported bucket size should fail")
+	}
+}
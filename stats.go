@@ -0,0 +1,328 @@
+package jupiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the histograms
+// of request latencies
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// numFillBins is the number of bins in the histogram of bucket fill
+const numFillBins = 10
+
+// fillBin returns the bin of the histogram of bucket fill for a bucket
+func fillBin(b *Bucket) int {
+	if b.NumEntries() == 0 {
+		return 0
+	}
+	bin := b.NumEntries() * numFillBins / b.MaxEntries()
+	if bin >= numFillBins {
+		bin = numFillBins - 1
+	}
+	return bin
+}
+
+// stats has the counters kept by a Jupiter.  They are protected by Jupiter.mu.
+type stats struct {
+	blocks        uint64
+	logicalBytes  uint64
+	physicalBytes uint64
+	requests      map[string]*Latency
+}
+
+// addBlock counts a new block stored in the data log
+func (s *stats) addBlock(size int) {
+	s.blocks++
+	s.physicalBytes += uint64(size)
+}
+
+// observe records the time taken by a request which started at a given time
+func (s *stats) observe(op string, start time.Time) {
+	if s.requests == nil {
+		s.requests = make(map[string]*Latency)
+	}
+	l := s.requests[op]
+	if l == nil {
+		l = &Latency{Buckets: make([]uint64, len(latencyBuckets))}
+		s.requests[op] = l
+	}
+	d := time.Since(start).Seconds()
+	l.Count++
+	l.Seconds += d
+	for i, b := range latencyBuckets {
+		if d <= b {
+			l.Buckets[i]++
+		}
+	}
+}
+
+// Latency is a histogram of the time taken by one kind of request.
+// Buckets[i] is the number of requests which took latencyBuckets[i]
+// seconds or less.
+type Latency struct {
+	Count   uint64   `json:"count"`
+	Seconds float64  `json:"seconds"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+// DataLogMetrics has the size of one data log
+type DataLogMetrics struct {
+	File string `json:"file"`
+	Size uint64 `json:"size"`
+}
+
+// CacheMetrics has the hits and misses of a BlockCache
+type CacheMetrics struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Metrics describes the state of a Jupiter.
+// LogicalBytes counts the data stored when the Jupiter was opened plus all
+// the data written since then, including duplicates; PhysicalBytes is the
+// data actually stored in the data log.
+type Metrics struct {
+	Blocks        uint64                    `json:"blocks"`
+	LogicalBytes  uint64                    `json:"logical_bytes"`
+	PhysicalBytes uint64                    `json:"physical_bytes"`
+	DedupRatio    float64                   `json:"dedup_ratio"`
+	DataLogs      []DataLogMetrics          `json:"data_logs"`
+	Buckets       uint32                    `json:"buckets"`
+	BucketFill    []uint64                  `json:"bucket_fill"` // number of buckets with 0-10%, 10-20%... of entries used
+	BinHeapDepth  int                       `json:"binheap_depth"`
+	Caches        map[string]CacheMetrics   `json:"caches,omitempty"`
+	Replicas      map[string]ReplicaMetrics `json:"replicas,omitempty"`
+	Clients       map[string]ClientMetrics  `json:"clients,omitempty"` // by identity
+	Requests      map[string]Latency        `json:"requests"`
+}
+
+// Metrics returns the current metrics of a Jupiter
+func (j *Jupiter) Metrics() Metrics {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	m := Metrics{
+		Blocks:        j.stats.blocks,
+		LogicalBytes:  j.stats.logicalBytes,
+		PhysicalBytes: j.stats.physicalBytes,
+		Buckets:       j.index.NumBuckets(),
+		BucketFill:    j.index.Fill(),
+		BinHeapDepth:  j.binheap.Depth(),
+		Requests:      make(map[string]Latency),
+	}
+	if m.PhysicalBytes > 0 {
+		m.DedupRatio = float64(m.LogicalBytes) / float64(m.PhysicalBytes)
+	}
+	size, _ := j.datalog.Size()
+	m.DataLogs = append(m.DataLogs, DataLogMetrics{File: j.datalog.filename, Size: size})
+	for op, l := range j.stats.requests {
+		m.Requests[op] = Latency{Count: l.Count, Seconds: l.Seconds, Buckets: append([]uint64(nil), l.Buckets...)}
+	}
+	return m
+}
+
+// A StatsHandler serves the metrics of a Jupiter over HTTP:
+// "/stats" returns them as JSON, and "/metrics" in the Prometheus text format.
+type StatsHandler struct {
+	j *Jupiter
+
+	mu       sync.Mutex
+	caches   map[string]*BlockCache
+	replicas []*Replica
+	servers  []*Server
+}
+
+// NewStatsHandler returns a StatsHandler for a Jupiter
+func NewStatsHandler(j *Jupiter) *StatsHandler {
+	return &StatsHandler{j: j, caches: make(map[string]*BlockCache)}
+}
+
+// AddCache adds the hits and misses of a BlockCache to the metrics
+func (h *StatsHandler) AddCache(name string, c *BlockCache) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.caches[name] = c
+}
+
+// AddReplica adds the state of a Replica to the metrics
+func (h *StatsHandler) AddReplica(r *Replica) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.replicas = append(h.replicas, r)
+}
+
+// AddServer adds the usage of a Server by its clients to the metrics
+func (h *StatsHandler) AddServer(s *Server) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.servers = append(h.servers, s)
+}
+
+// Metrics returns the metrics of the Jupiter, its caches, its replicas
+// and the clients of its servers
+func (h *StatsHandler) Metrics() Metrics {
+	m := h.j.Metrics()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, c := range h.caches {
+		if m.Caches == nil {
+			m.Caches = make(map[string]CacheMetrics)
+		}
+		var cm CacheMetrics
+		cm.Hits, cm.Misses = c.Stats()
+		if cm.Hits+cm.Misses > 0 {
+			cm.HitRate = float64(cm.Hits) / float64(cm.Hits+cm.Misses)
+		}
+		m.Caches[name] = cm
+	}
+	for _, r := range h.replicas {
+		if m.Replicas == nil {
+			m.Replicas = make(map[string]ReplicaMetrics)
+		}
+		m.Replicas[r.Addr] = r.Metrics()
+	}
+	for _, s := range h.servers {
+		for identity, u := range s.Usage() {
+			if m.Clients == nil {
+				m.Clients = make(map[string]ClientMetrics)
+			}
+			c := m.Clients[identity]
+			c.Requests += u.Requests
+			c.WrittenBytes += u.WrittenBytes
+			c.Blocks += u.Blocks
+			c.QuotaBytes = u.QuotaBytes
+			c.QuotaDenied += u.QuotaDenied
+			c.RateDenied += u.RateDenied
+			m.Clients[identity] = c
+		}
+	}
+	return m
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/stats":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(h.Metrics())
+	case "/metrics":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePrometheus(w, h.Metrics())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writePrometheus writes metrics in the Prometheus text format
+func writePrometheus(w io.Writer, m Metrics) {
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("jupiter_blocks", "gauge", "Number of blocks stored.")
+	fmt.Fprintf(w, "jupiter_blocks %d\n", m.Blocks)
+	metric("jupiter_logical_bytes", "counter", "Bytes written, including duplicates.")
+	fmt.Fprintf(w, "jupiter_logical_bytes %d\n", m.LogicalBytes)
+	metric("jupiter_physical_bytes", "gauge", "Bytes of data stored.")
+	fmt.Fprintf(w, "jupiter_physical_bytes %d\n", m.PhysicalBytes)
+	metric("jupiter_dedup_ratio", "gauge", "Logical bytes divided by physical bytes.")
+	fmt.Fprintf(w, "jupiter_dedup_ratio %g\n", m.DedupRatio)
+	metric("jupiter_datalog_size_bytes", "gauge", "Size of each data log.")
+	for _, d := range m.DataLogs {
+		fmt.Fprintf(w, "jupiter_datalog_size_bytes{file=%q} %d\n", d.File, d.Size)
+	}
+	metric("jupiter_buckets", "gauge", "Number of buckets in the index.")
+	fmt.Fprintf(w, "jupiter_buckets %d\n", m.Buckets)
+	metric("jupiter_buckets_by_fill", "gauge", "Number of buckets by fraction of entries used.")
+	for i, n := range m.BucketFill {
+		fmt.Fprintf(w, "jupiter_buckets_by_fill{fill=\"%d-%d%%\"} %d\n", i*100/numFillBins, (i+1)*100/numFillBins, n)
+	}
+	metric("jupiter_binheap_depth", "gauge", "Depth of the binary heap.")
+	fmt.Fprintf(w, "jupiter_binheap_depth %d\n", m.BinHeapDepth)
+	if len(m.Caches) > 0 {
+		names := make([]string, 0, len(m.Caches))
+		for name := range m.Caches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		metric("jupiter_cache_hits_total", "counter", "Number of cache hits.")
+		for _, name := range names {
+			fmt.Fprintf(w, "jupiter_cache_hits_total{cache=%q} %d\n", name, m.Caches[name].Hits)
+		}
+		metric("jupiter_cache_misses_total", "counter", "Number of cache misses.")
+		for _, name := range names {
+			fmt.Fprintf(w, "jupiter_cache_misses_total{cache=%q} %d\n", name, m.Caches[name].Misses)
+		}
+	}
+	if len(m.Replicas) > 0 {
+		addrs := make([]string, 0, len(m.Replicas))
+		for addr := range m.Replicas {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		metric("jupiter_replica_lag_bytes", "gauge", "Bytes in the data log not yet copied to each replica.")
+		for _, addr := range addrs {
+			fmt.Fprintf(w, "jupiter_replica_lag_bytes{replica=%q} %d\n", addr, m.Replicas[addr].LagBytes)
+		}
+		metric("jupiter_replica_blocks_total", "counter", "Number of blocks copied to each replica.")
+		for _, addr := range addrs {
+			fmt.Fprintf(w, "jupiter_replica_blocks_total{replica=%q} %d\n", addr, m.Replicas[addr].Blocks)
+		}
+		metric("jupiter_replica_errors_total", "counter", "Number of failed replication attempts.")
+		for _, addr := range addrs {
+			fmt.Fprintf(w, "jupiter_replica_errors_total{replica=%q} %d\n", addr, m.Replicas[addr].Errors)
+		}
+	}
+	if len(m.Clients) > 0 {
+		ids := make([]string, 0, len(m.Clients))
+		for id := range m.Clients {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		metric("jupiter_client_requests_total", "counter", "Number of requests of each client.")
+		for _, id := range ids {
+			fmt.Fprintf(w, "jupiter_client_requests_total{client=%q} %d\n", id, m.Clients[id].Requests)
+		}
+		metric("jupiter_client_written_bytes_total", "counter", "Bytes of new blocks written by each client.")
+		for _, id := range ids {
+			fmt.Fprintf(w, "jupiter_client_written_bytes_total{client=%q} %d\n", id, m.Clients[id].WrittenBytes)
+		}
+		metric("jupiter_client_blocks_total", "counter", "Number of new blocks written by each client.")
+		for _, id := range ids {
+			fmt.Fprintf(w, "jupiter_client_blocks_total{client=%q} %d\n", id, m.Clients[id].Blocks)
+		}
+		metric("jupiter_client_quota_bytes", "gauge", "Quota of each client, if it has one.")
+		for _, id := range ids {
+			if q := m.Clients[id].QuotaBytes; q > 0 {
+				fmt.Fprintf(w, "jupiter_client_quota_bytes{client=%q} %d\n", id, q)
+			}
+		}
+		metric("jupiter_client_denied_total", "counter", "Number of requests of each client denied by its limits.")
+		for _, id := range ids {
+			fmt.Fprintf(w, "jupiter_client_denied_total{client=%q,reason=\"quota\"} %d\n", id, m.Clients[id].QuotaDenied)
+			fmt.Fprintf(w, "jupiter_client_denied_total{client=%q,reason=\"rate\"} %d\n", id, m.Clients[id].RateDenied)
+		}
+	}
+	ops := make([]string, 0, len(m.Requests))
+	for op := range m.Requests {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	metric("jupiter_request_duration_seconds", "histogram", "Time taken by requests.")
+	for _, op := range ops {
+		l := m.Requests[op]
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(w, "jupiter_request_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", op, b, l.Buckets[i])
+		}
+		fmt.Fprintf(w, "jupiter_request_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", op, l.Count)
+		fmt.Fprintf(w, "jupiter_request_duration_seconds_sum{op=%q} %g\n", op, l.Seconds)
+		fmt.Fprintf(w, "jupiter_request_duration_seconds_count{op=%q} %d\n", op, l.Count)
+	}
+}
@@ -0,0 +1,83 @@
+package jupiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		j.Write(0, []byte("same block"))
+	}
+	if _, err := j.Write(1, []byte("same block")); err == nil {
+		t.Errorf("Write() with another type succeeded")
+	}
+	j.Read(GetScore([]byte("same block")))
+	m := j.Metrics()
+	if m.Blocks != 1 || m.PhysicalBytes != 10 || m.LogicalBytes != 40 || m.DedupRatio != 4 {
+		t.Errorf("Metrics() = %+v", m)
+	}
+	if m.Buckets != 1 || m.BucketFill[0] != 1 || m.Requests["write"].Count != 5 || m.Requests["read"].Count != 1 {
+		t.Errorf("Metrics() = %+v", m)
+	}
+
+	h := NewStatsHandler(j)
+	c := NewBlockCache(j, 1000)
+	c.Read(GetScore([]byte("same block")))
+	c.Read(GetScore([]byte("same block")))
+	h.AddCache("test", c)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var m2 Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &m2); err != nil {
+		t.Fatalf("/stats: %v", err)
+	}
+	if m2.Caches["test"].Hits != 1 || m2.Caches["test"].HitRate != 0.5 {
+		t.Errorf("/stats: caches = %+v", m2.Caches)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, s := range []string{"jupiter_blocks 1\n", "jupiter_dedup_ratio 4\n", `jupiter_request_duration_seconds_count{op="write"} 5`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("/metrics does not contain %q", s)
+		}
+	}
+}
+
+func TestBucketFill(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	for i := 0; i < 5000; i++ {
+		if _, err := j.Write(0, []byte(fmt.Sprint("block ", i))); err != nil {
+			t.Fatalf("Write(): %v", err)
+		}
+	}
+	m := j.Metrics()
+	if m.Buckets < 2 {
+		t.Fatalf("%d buckets: no bucket has been split", m.Buckets)
+	}
+	want := make([]uint64, numFillBins)
+	for n := uint32(0); n < m.Buckets; n++ {
+		b, err := j.index.Bucket(n)
+		if err != nil {
+			t.Fatalf("Bucket(%d): %v", n, err)
+		}
+		want[fillBin(b)]++
+	}
+	if !reflect.DeepEqual(m.BucketFill, want) {
+		t.Errorf("BucketFill = %v, want %v", m.BucketFill, want)
+	}
+}
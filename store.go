@@ -0,0 +1,254 @@
+package jupiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// A Store reads and writes blocks.  Jupiter, MemStore, CachingStore,
+// EncryptedStore, Client and Conn are Stores.  Package storetest checks that a Store
+// behaves like a Jupiter.
+type Store interface {
+	BlockReader
+	BlockWriter
+	Sync() error
+	Close() error
+}
+
+var (
+	_ Store = (*Jupiter)(nil)
+	_ Store = (*Client)(nil)
+	_ Store = (*Conn)(nil)
+	_ Store = (*MemStore)(nil)
+	_ Store = (*CachingStore)(nil)
+	_ Store = (*EncryptedStore)(nil)
+)
+
+// A CacheMode says when the blocks written to a CachingStore are sent
+// to the remote store.
+type CacheMode int
+
+const (
+	// WriteThrough sends every block to the remote store before Write returns
+	WriteThrough CacheMode = iota
+	// WriteBack keeps the blocks in the local store, and sends them to
+	// the remote store on Sync
+	WriteBack
+)
+
+// A CachingStore serves blocks from a local Jupiter, and reads the ones it
+// does not have from a remote Store, keeping a copy in the local one.
+//
+// Blocks cannot be removed from a Jupiter, so when the data log of the
+// local one grows beyond a size limit, all its blocks are discarded
+// (after sending the pending ones to the remote store).
+type CachingStore struct {
+	local   *Jupiter
+	remote  Store
+	mode    CacheMode
+	maxSize uint64
+
+	tier     sync.RWMutex // held for writing while the local store is reset
+	mu       sync.Mutex
+	pending  []Score // blocks not yet sent to the remote store
+	rejected []Score // blocks the remote store refused to store
+	hits     uint64
+	misses   uint64
+}
+
+// NewCachingStore returns a CachingStore with a local and a remote store.
+// The local Jupiter is reset when its data log is larger than maxSize bytes;
+// 0 means no limit.  Both stores must use the same Hasher.
+func NewCachingStore(local *Jupiter, remote Store, mode CacheMode, maxSize uint64) *CachingStore {
+	return &CachingStore{local: local, remote: remote, mode: mode, maxSize: maxSize}
+}
+
+// Read returns a block from the local store or, if it is not there
+// (or it cannot be read), from the remote one.  Failing to keep a copy
+// in the local store is logged, but it is not an error.
+func (c *CachingStore) Read(score Score) (Type, []byte, error) {
+	t, b, err := c.local.Read(score)
+	if err == nil {
+		c.mu.Lock()
+		c.hits++
+		c.mu.Unlock()
+		return t, b, nil
+	}
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	t, b, err = c.remote.Read(score)
+	if err != nil {
+		return t, b, err
+	}
+	if err := c.store(t, b); err != nil {
+		c.local.logger().Log(LevelWarn, "cannot keep a copy of a block in the cache", Field{"score", score}, Field{"error", err})
+	}
+	return t, b, nil
+}
+
+// store keeps a copy of a block in the local store
+func (c *CachingStore) store(t Type, b []byte) error {
+	if err := c.checkSize(); err != nil {
+		return err
+	}
+	c.tier.RLock()
+	defer c.tier.RUnlock()
+	_, err := c.local.Write(t, b)
+	return err
+}
+
+// checkSize discards the blocks of the local store if it is too large
+func (c *CachingStore) checkSize() error {
+	if c.maxSize == 0 {
+		return nil
+	}
+	if size, err := c.local.size(); err != nil || size < c.maxSize {
+		return err
+	}
+	c.tier.Lock()
+	defer c.tier.Unlock()
+	// another goroutine may have reset it already
+	if size, err := c.local.size(); err != nil || size < c.maxSize {
+		return err
+	}
+	if _, err := c.flush(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.rejected = nil
+	c.mu.Unlock()
+	return c.local.reset()
+}
+
+// Write stores a block.  In WriteThrough mode, it is stored in the remote
+// store first; in WriteBack mode, it is sent there on the next Sync.
+func (c *CachingStore) Write(t Type, b []byte) (Score, error) {
+	if c.mode == WriteThrough {
+		score, err := c.remote.Write(t, b)
+		if err != nil {
+			return score, err
+		}
+		if err := c.store(t, b); err != nil {
+			return score, err
+		}
+		return score, nil
+	}
+	if err := c.checkSize(); err != nil {
+		return ZeroScore, err
+	}
+	c.tier.RLock()
+	defer c.tier.RUnlock()
+	score, isNew, err := c.local.store(context.Background(), t, b)
+	if err != nil {
+		return score, err
+	}
+	if isNew {
+		c.mu.Lock()
+		c.pending = append(c.pending, score)
+		c.mu.Unlock()
+	}
+	return score, nil
+}
+
+// Has reports whether a block is in the local or the remote store
+func (c *CachingStore) Has(score Score) bool {
+	return c.local.Has(score) || c.remote.Has(score)
+}
+
+// flush sends the pending blocks to the remote store.  The blocks which
+// cannot be stored there are moved to the rejected list and logged, so
+// that they do not hold back the rest, and rejected describes them.
+// Any other error stops the flush, and the block is sent again next time.
+func (c *CachingStore) flush() (rejected error, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for len(c.pending) > 0 {
+		score := c.pending[0]
+		if err := c.send(score); isRejection(err) {
+			c.local.logger().Log(LevelWarn, "block rejected by the remote store", Field{"score", score}, Field{"error", err})
+			c.rejected = append(c.rejected, score)
+			if n++; rejected == nil {
+				rejected = err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		c.pending = c.pending[1:]
+	}
+	if rejected != nil {
+		rejected = fmt.Errorf("jupiter: CachingStore: %d blocks rejected by the remote store: %w", n, rejected)
+	}
+	return rejected, nil
+}
+
+// send copies a block from the local store to the remote one
+func (c *CachingStore) send(score Score) error {
+	t, b, err := c.local.Read(score)
+	if err != nil {
+		return err
+	}
+	s, err := c.remote.Write(t, b)
+	if err != nil {
+		return err
+	}
+	if !s.Equal(score) {
+		return fmt.Errorf("jupiter: CachingStore: block %s stored with score %s in the remote store: %w", score, s, ErrCorrupt)
+	}
+	return nil
+}
+
+// isRejection reports whether an error sending a block to the remote store
+// would happen again, because of the block itself
+func isRejection(err error) bool {
+	return errors.Is(err, ErrTypeMismatch) || errors.Is(err, ErrTooLarge) || errors.Is(err, ErrCorrupt) || errors.Is(err, ErrNotFound)
+}
+
+// Rejected returns the blocks written in WriteBack mode which could not be
+// stored in the remote store, such as those stored there with another type.
+// They stay in the local store until it is reset.
+func (c *CachingStore) Rejected() []Score {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Score(nil), c.rejected...)
+}
+
+// Sync sends the pending blocks to the remote store, and syncs both stores.
+// If any block is rejected by the remote store, the rest are sent and
+// synced, and Sync returns an error.
+func (c *CachingStore) Sync() error {
+	rejected, err := c.flush()
+	if err != nil {
+		return err
+	}
+	if err := c.remote.Sync(); err != nil {
+		return err
+	}
+	if err := c.local.Sync(); err != nil {
+		return err
+	}
+	return rejected
+}
+
+// Close syncs and closes both stores
+func (c *CachingStore) Close() error {
+	err := c.Sync()
+	if e := c.remote.Close(); err == nil {
+		err = e
+	}
+	if e := c.local.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Stats returns the number of reads served by the local store (hits)
+// and by the remote one (misses).
+func (c *CachingStore) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,90 @@
+package jupiter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCachingStore(t *testing.T) {
+	local, _ := New()
+	remote, _ := New()
+	c := NewCachingStore(local, remote, WriteThrough, 0)
+
+	s, err := c.Write(1, []byte("written through"))
+	if err != nil || !local.Has(s) || !remote.Has(s) {
+		t.Errorf("Write() in WriteThrough mode: %v", err)
+	}
+
+	// read-through
+	s, _ = remote.Write(2, []byte("only remote"))
+	for i := 0; i < 2; i++ {
+		typ, b, err := c.Read(s)
+		if err != nil || typ != 2 || string(b) != "only remote" {
+			t.Errorf("Read() = %d, %q, %v", typ, b, err)
+		}
+	}
+	if hits, misses := c.Stats(); hits != 1 || misses != 1 || !local.Has(s) {
+		t.Errorf("Stats() = %d, %d", hits, misses)
+	}
+	if !c.Has(s) || c.Has(GetScore([]byte("missing"))) {
+		t.Errorf("Has() is wrong")
+	}
+
+	// write-back, with a size limit in the local store
+	local, _ = New()
+	c = NewCachingStore(local, remote, WriteBack, 20000)
+	var scores []Score
+	for i := 0; i < 100; i++ {
+		s, err := c.Write(3, bytes.Repeat([]byte(fmt.Sprintf("%10d", i)), 100))
+		if err != nil {
+			t.Fatalf("Write(%d): %v", i, err)
+		}
+		scores = append(scores, s)
+	}
+	if remote.Has(scores[99]) {
+		t.Errorf("block in the remote store before Sync in WriteBack mode")
+	}
+	if size, _ := local.size(); size > 21000 {
+		t.Errorf("local store has %d bytes, limit is 20000", size)
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Sync(): %v", err)
+	}
+	for i, s := range scores {
+		if !remote.Has(s) {
+			t.Fatalf("block %d not in the remote store after Sync", i)
+		}
+		if _, _, err := c.Read(s); err != nil {
+			t.Fatalf("Read(%d): %v", i, err)
+		}
+	}
+}
+
+func TestCachingStoreErrors(t *testing.T) {
+	local, _ := New()
+	remote, _ := New()
+	c := NewCachingStore(local, remote, WriteBack, 0)
+
+	// a block rejected by the remote store does not hold back the rest
+	remote.Write(2, []byte("conflict"))
+	rejected, _ := c.Write(1, []byte("conflict"))
+	s, _ := c.Write(1, []byte("accepted"))
+	if err := c.Sync(); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Sync() with a rejected block: %v, want ErrTypeMismatch", err)
+	}
+	if r := c.Rejected(); !remote.Has(s) || len(r) != 1 || !r[0].Equal(rejected) {
+		t.Errorf("after Sync(): Rejected() = %v", r)
+	}
+	if err := c.Sync(); err != nil {
+		t.Errorf("second Sync(): %v", err)
+	}
+
+	// a read from the remote store succeeds even if it cannot be cached
+	s, _ = remote.Write(1, []byte("only remote"))
+	local.readOnly = true
+	if _, b, err := c.Read(s); err != nil || string(b) != "only remote" {
+		t.Errorf("Read() = %q, %v", b, err)
+	}
+}
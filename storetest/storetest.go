@@ -0,0 +1,129 @@
+// Package storetest checks that an implementation of jupiter.Store
+// behaves like a Jupiter.
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/cespedes/jupiter"
+)
+
+// TestStore runs the conformance tests on the Stores returned by
+// newStore.  Each test gets a new empty Store, and closes it when done.
+func TestStore(t *testing.T, newStore func(t *testing.T) jupiter.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s jupiter.Store)
+	}{
+		{"ReadWrite", testReadWrite},
+		{"Dedup", testDedup},
+		{"Types", testTypes},
+		{"NotFound", testNotFound},
+		{"Large", testLarge},
+		{"Sync", testSync},
+	}
+	for _, test := range tests {
+		fn := test.fn
+		t.Run(test.name, func(t *testing.T) {
+			s := newStore(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close(): %v", err)
+				}
+			}()
+			fn(t, s)
+		})
+	}
+}
+
+func testReadWrite(t *testing.T, s jupiter.Store) {
+	blocks := [][]byte{[]byte("hello, world"), {}, bytes.Repeat([]byte{0}, 1000)}
+	var scores []jupiter.Score
+	for i, b := range blocks {
+		score, err := s.Write(jupiter.Type(i), b)
+		if err != nil {
+			t.Fatalf("Write(%q): %v", b, err)
+		}
+		scores = append(scores, score)
+	}
+	for i, b := range blocks {
+		if !s.Has(scores[i]) {
+			t.Errorf("Has(%s) = false after writing it", scores[i])
+		}
+		typ, got, err := s.Read(scores[i])
+		if err != nil || typ != jupiter.Type(i) || !bytes.Equal(got, b) {
+			t.Errorf("Read(%s) = %d, %q, %v; want %d, %q", scores[i], typ, got, err, i, b)
+		}
+	}
+}
+
+func testDedup(t *testing.T, s jupiter.Store) {
+	s1, err1 := s.Write(7, []byte("same block"))
+	s2, err2 := s.Write(7, []byte("same block"))
+	if err1 != nil || err2 != nil || !s1.Equal(s2) {
+		t.Errorf("writing a block twice: %s, %v; %s, %v", s1, err1, s2, err2)
+	}
+	s3, err := s.Write(7, []byte("another block"))
+	if err != nil || s3.Equal(s1) {
+		t.Errorf("Write() of another block = %s, %v", s3, err)
+	}
+}
+
+func testTypes(t *testing.T, s jupiter.Store) {
+	score, err := s.Write(1, []byte("typed block"))
+	if err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if _, err := s.Write(2, []byte("typed block")); !errors.Is(err, jupiter.ErrTypeMismatch) {
+		t.Errorf("Write() with another type: %v, want ErrTypeMismatch", err)
+	}
+	if typ, _, err := s.Read(score); err != nil || typ != 1 {
+		t.Errorf("Read() = %d, %v; want the first type", typ, err)
+	}
+	if _, err := s.Write(255, []byte("type 255")); err != nil {
+		t.Errorf("Write() with type 255: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, s jupiter.Store) {
+	for _, score := range []jupiter.Score{jupiter.ZeroScore, jupiter.GetScore([]byte("never written"))} {
+		if _, _, err := s.Read(score); !errors.Is(err, jupiter.ErrNotFound) {
+			t.Errorf("Read(%s): %v, want ErrNotFound", score, err)
+		}
+		if s.Has(score) {
+			t.Errorf("Has(%s) = true for a missing block", score)
+		}
+	}
+}
+
+func testLarge(t *testing.T, s jupiter.Store) {
+	b := make([]byte, jupiter.MaxChunkSize)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	score, err := s.Write(3, b)
+	if err != nil {
+		t.Fatalf("Write() of %d bytes: %v", len(b), err)
+	}
+	if _, got, err := s.Read(score); err != nil || !bytes.Equal(got, b) {
+		t.Errorf("Read() of a large block: %d bytes, %v", len(got), err)
+	}
+	if _, err := s.Write(3, make([]byte, jupiter.MaxChunkSize+1)); !errors.Is(err, jupiter.ErrTooLarge) {
+		t.Errorf("Write() of %d bytes: %v, want ErrTooLarge", jupiter.MaxChunkSize+1, err)
+	}
+}
+
+func testSync(t *testing.T, s jupiter.Store) {
+	score, err := s.Write(1, []byte("synced block"))
+	if err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	if err := s.Sync(); err != nil {
+		t.Errorf("Sync(): %v", err)
+	}
+	if !s.Has(score) {
+		t.Errorf("block missing after Sync()")
+	}
+}
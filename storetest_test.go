@@ -0,0 +1,83 @@
+package jupiter_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cespedes/jupiter"
+	"github.com/cespedes/jupiter/storetest"
+)
+
+func newJupiter(t *testing.T) *jupiter.Jupiter {
+	j, err := jupiter.New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	return j
+}
+
+func TestStores(t *testing.T) {
+	t.Run("Jupiter", func(t *testing.T) {
+		storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+			return newJupiter(t)
+		})
+	})
+	t.Run("MemStore", func(t *testing.T) {
+		storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+			return jupiter.NewMemStore(nil)
+		})
+	})
+	t.Run("Conn", func(t *testing.T) {
+		var listeners []net.Listener
+		defer func() {
+			for _, l := range listeners {
+				l.Close()
+			}
+		}()
+		storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			listeners = append(listeners, l)
+			go jupiter.NewServer(newJupiter(t)).Serve(l)
+			c, err := jupiter.Dial(l.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial(): %v", err)
+			}
+			return c
+		})
+	})
+	t.Run("Client", func(t *testing.T) {
+		var servers []*httptest.Server
+		defer func() {
+			for _, ts := range servers {
+				ts.Close()
+			}
+		}()
+		storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+			ts := httptest.NewServer(jupiter.NewGateway(newJupiter(t)))
+			servers = append(servers, ts)
+			return jupiter.NewClient(ts.URL)
+		})
+	})
+	t.Run("EncryptedStore", func(t *testing.T) {
+		storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+			e, err := jupiter.NewEncryptedStore(jupiter.NewMemStore(nil), make([]byte, jupiter.UserKeySize))
+			if err != nil {
+				t.Fatalf("NewEncryptedStore(): %v", err)
+			}
+			return e
+		})
+	})
+	for _, mode := range []jupiter.CacheMode{jupiter.WriteThrough, jupiter.WriteBack} {
+		mode := mode
+		name := map[jupiter.CacheMode]string{jupiter.WriteThrough: "WriteThrough", jupiter.WriteBack: "WriteBack"}[mode]
+		t.Run("CachingStore/"+name, func(t *testing.T) {
+			storetest.TestStore(t, func(t *testing.T) jupiter.Store {
+				return jupiter.NewCachingStore(newJupiter(t), jupiter.NewMemStore(nil), mode, 0)
+			})
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package vac
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cespedes/jupiter"
+)
+
+// A Writer stores trees of files in a Jupiter.
+type Writer struct {
+	j     *jupiter.Jupiter
+	stats jupiter.ObjectStats
+}
+
+// NewWriter returns a Writer which stores its data in j.
+func NewWriter(j *jupiter.Jupiter) *Writer {
+	return &Writer{j: j}
+}
+
+// Archive stores the contents of a directory, and returns the score of
+// the root block of the snapshot.
+func (w *Writer) Archive(dir string) (jupiter.Score, error) {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return jupiter.ZeroScore, err
+	}
+	if !fi.IsDir() {
+		return jupiter.ZeroScore, &os.PathError{Op: "archive", Path: dir, Err: os.ErrInvalid}
+	}
+	e, err := w.writeEntry(dir, fi)
+	if err != nil {
+		return jupiter.ZeroScore, err
+	}
+	return writeRoot(w.j, &Root{Time: time.Now(), Entry: e})
+}
+
+// Stats returns the number of bytes and blocks written so far.
+func (w *Writer) Stats() jupiter.ObjectStats {
+	return w.stats
+}
+
+// writeEntry stores a file, directory or symbolic link, and returns its entry.
+// Other kinds of files (devices, sockets, named pipes...) are skipped, and
+// writeEntry returns nil for them.
+func (w *Writer) writeEntry(path string, fi os.FileInfo) (*Entry, error) {
+	e := &Entry{
+		Name:    fi.Name(),
+		Mode:    fi.Mode(),
+		ModTime: fi.ModTime(),
+	}
+	e.Uid, e.Gid = owner(fi)
+	switch {
+	case fi.Mode().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		ow := jupiter.NewObjectWriter(w.j)
+		n, err := io.Copy(ow, f)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.close(ow); err != nil {
+			return nil, err
+		}
+		e.Size = uint64(n)
+		e.Score = ow.Score()
+	case fi.IsDir():
+		list, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		ow := jupiter.NewObjectWriter(w.j)
+		for _, child := range list {
+			ce, err := w.writeEntry(filepath.Join(path, child.Name()), child)
+			if err != nil {
+				return nil, err
+			}
+			if ce == nil {
+				continue
+			}
+			if _, err := ow.Write(ce.appendTo(nil)); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.close(ow); err != nil {
+			return nil, err
+		}
+		e.Score = ow.Score()
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		e.Target = target
+		e.Size = uint64(len(target))
+	default:
+		return nil, nil
+	}
+	return e, nil
+}
+
+// close closes an ObjectWriter, and adds its statistics to the Writer's.
+func (w *Writer) close(ow *jupiter.ObjectWriter) error {
+	if err := ow.Close(); err != nil {
+		return err
+	}
+	s := ow.Stats()
+	w.stats.Bytes += s.Bytes
+	w.stats.Blocks += s.Blocks
+	w.stats.StoredBytes += s.StoredBytes
+	w.stats.StoredBlocks += s.StoredBlocks
+	return nil
+}
@@ -0,0 +1,37 @@
+package vac
+
+import (
+	"github.com/cespedes/jupiter"
+)
+
+// Export adds the snapshot with a given root score to an export stream:
+// the contents of every file and directory, and then the root block.
+func Export(e *jupiter.Exporter, j jupiter.BlockReader, score jupiter.Score) error {
+	r, err := ReadRoot(j, score)
+	if err != nil {
+		return err
+	}
+	if err := exportEntry(e, j, r.Entry); err != nil {
+		return err
+	}
+	return e.WriteBlock(score)
+}
+
+func exportEntry(e *jupiter.Exporter, j jupiter.BlockReader, entry *Entry) error {
+	switch {
+	case entry.Mode.IsRegular():
+		return e.WriteBlock(entry.Score)
+	case entry.Mode.IsDir():
+		entries, err := ReadDir(j, entry)
+		if err != nil {
+			return err
+		}
+		for _, child := range entries {
+			if err := exportEntry(e, j, child); err != nil {
+				return err
+			}
+		}
+		return e.WriteBlock(entry.Score)
+	}
+	return nil
+}
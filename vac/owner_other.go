@@ -0,0 +1,13 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package vac
+
+import (
+	"os"
+)
+
+// owner returns the user and group owning a file
+func owner(fi os.FileInfo) (uid, gid uint32) {
+	return 0, 0
+}
@@ -0,0 +1,106 @@
+package vac
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cespedes/jupiter"
+)
+
+// Restore extracts the snapshot with a given root score into a directory.
+// File owners are only restored when running as root.
+func Restore(j jupiter.BlockReader, score jupiter.Score, dir string) error {
+	r, err := ReadRoot(j, score)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return restoreEntry(j, r.Entry, dir)
+}
+
+func restoreEntry(j jupiter.BlockReader, e *Entry, path string) error {
+	switch {
+	case e.Mode.IsRegular():
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNofollow, 0600)
+		if err != nil {
+			return err
+		}
+		r, err := Open(j, e)
+		if err == nil {
+			_, err = io.Copy(f, r)
+		}
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+	case e.Mode.IsDir():
+		if err := os.Mkdir(path, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		entries, err := ReadDir(j, e)
+		if err != nil {
+			return err
+		}
+		// Symbolic links are restored after all their siblings, so
+		// that no other entry is written through them
+		seen := make(map[string]bool, len(entries))
+		var links []*Entry
+		for _, child := range entries {
+			if child.Name == "" || child.Name == "." || child.Name == ".." || filepath.Base(child.Name) != child.Name || seen[child.Name] {
+				return errCorrupt
+			}
+			seen[child.Name] = true
+			if child.Mode&os.ModeSymlink != 0 {
+				links = append(links, child)
+				continue
+			}
+			if err := restoreChild(j, child, path); err != nil {
+				return err
+			}
+		}
+		for _, child := range links {
+			if err := restoreChild(j, child, path); err != nil {
+				return err
+			}
+		}
+	case e.Mode&os.ModeSymlink != 0:
+		if err := os.Symlink(e.Target, path); err != nil {
+			return err
+		}
+		if os.Geteuid() == 0 {
+			return os.Lchown(path, int(e.Uid), int(e.Gid))
+		}
+		return nil
+	default:
+		return nil
+	}
+	if os.Geteuid() == 0 {
+		if err := os.Chown(path, int(e.Uid), int(e.Gid)); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(path, e.Mode.Perm()|e.Mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(path, e.ModTime, e.ModTime)
+}
+
+// restoreChild restores an entry inside the directory dir.  Only a
+// directory may already exist in its place, and never a symbolic link.
+func restoreChild(j jupiter.BlockReader, e *Entry, dir string) error {
+	path := filepath.Join(dir, e.Name)
+	fi, err := os.Lstat(path)
+	switch {
+	case err == nil && (!fi.IsDir() || !e.Mode.IsDir()):
+		return fmt.Errorf("vac: %s: %w", path, os.ErrExist)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	return restoreEntry(j, e, path)
+}
@@ -0,0 +1,9 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package vac
+
+import "syscall"
+
+// oNofollow makes os.OpenFile fail if the file is a symbolic link
+const oNofollow = syscall.O_NOFOLLOW
@@ -0,0 +1,181 @@
+// Package vac stores trees of files and directories in a Jupiter, in a way
+// similar to the vac program in Plan 9.
+//
+// The contents of every file are stored as a Jupiter object.  The contents
+// of every directory are also stored as an object, with the list of its
+// entries.  A snapshot of a whole tree is identified by the score of a
+// root block, which has the time of the snapshot and the entry of the
+// top directory.
+package vac
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cespedes/jupiter"
+)
+
+const (
+	RootType jupiter.Type = 0x30 // type of the root block of a snapshot
+
+	rootMagic   = "Jvac"
+	rootVersion = 1
+)
+
+// An Entry describes a file, a directory or a symbolic link.
+type Entry struct {
+	Name    string
+	Mode    os.FileMode
+	ModTime time.Time
+	Uid     uint32
+	Gid     uint32
+	Size    uint64
+	Target  string        // target of a symbolic link
+	Score   jupiter.Score // root of the contents of a file or directory
+}
+
+// A Root describes a snapshot.
+type Root struct {
+	Time  time.Time
+	Entry *Entry
+}
+
+var errCorrupt = fmt.Errorf("vac: corrupt entry: %w", jupiter.ErrCorrupt)
+
+// Encoding of an entry (all integers are big-endian):
+// * name length (2 bytes) and name
+// * mode (4 bytes)
+// * modification time, in nanoseconds since the Unix epoch (8 bytes)
+// * uid (4 bytes) and gid (4 bytes)
+// * size (8 bytes)
+// * symbolic link target length (2 bytes) and target
+// * score (jupiter.ScoreSize bytes)
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+func (e *Entry) appendTo(b []byte) []byte {
+	b = appendString(b, e.Name)
+	b = appendUint(b, uint64(e.Mode), 4)
+	b = appendUint(b, uint64(e.ModTime.UnixNano()), 8)
+	b = appendUint(b, uint64(e.Uid), 4)
+	b = appendUint(b, uint64(e.Gid), 4)
+	b = appendUint(b, e.Size, 8)
+	b = appendString(b, e.Target)
+	return append(b, e.Score.Bytes()...)
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = errCorrupt
+		return make([]byte, n)
+	}
+	r := d.b[:n]
+	d.b = d.b[n:]
+	return r
+}
+
+func (d *decoder) uint(n int) uint64 {
+	var v uint64
+	for _, c := range d.bytes(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(int(d.uint(2))))
+}
+
+func (d *decoder) entry() *Entry {
+	e := new(Entry)
+	e.Name = d.string()
+	e.Mode = os.FileMode(d.uint(4))
+	e.ModTime = time.Unix(0, int64(d.uint(8)))
+	e.Uid = uint32(d.uint(4))
+	e.Gid = uint32(d.uint(4))
+	e.Size = d.uint(8)
+	e.Target = d.string()
+	e.Score, _ = jupiter.ScoreFromBytes(d.bytes(jupiter.ScoreSize))
+	return e
+}
+
+// ReadRoot reads the root block of a snapshot.
+func ReadRoot(j jupiter.BlockReader, score jupiter.Score) (*Root, error) {
+	t, b, err := j.Read(score)
+	if err != nil {
+		return nil, err
+	}
+	if t != RootType {
+		return nil, fmt.Errorf("vac: %s is not a root block", score)
+	}
+	if len(b) < 5 || string(b[:4]) != rootMagic || b[4] != rootVersion {
+		return nil, fmt.Errorf("vac: %s: invalid root block", score)
+	}
+	d := decoder{b: b[5:]}
+	r := &Root{Time: time.Unix(0, int64(d.uint(8)))}
+	r.Entry = d.entry()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !r.Entry.Mode.IsDir() {
+		return nil, fmt.Errorf("vac: %s: root is not a directory", score)
+	}
+	return r, nil
+}
+
+// writeRoot stores the root block of a snapshot.
+func writeRoot(j *jupiter.Jupiter, r *Root) (jupiter.Score, error) {
+	b := append([]byte(rootMagic), rootVersion)
+	b = appendUint(b, uint64(r.Time.UnixNano()), 8)
+	b = r.Entry.appendTo(b)
+	return j.Write(RootType, b)
+}
+
+// ReadDir returns the entries of a directory.
+func ReadDir(j jupiter.BlockReader, dir *Entry) ([]*Entry, error) {
+	if !dir.Mode.IsDir() {
+		return nil, fmt.Errorf("vac: %s is not a directory", dir.Name)
+	}
+	r, err := jupiter.NewObjectReader(j, dir.Score)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	d := decoder{b: b}
+	for len(d.b) > 0 && d.err == nil {
+		entries = append(entries, d.entry())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return entries, nil
+}
+
+// Open returns a reader for the contents of a file.
+func Open(j jupiter.BlockReader, file *Entry) (*jupiter.ObjectReader, error) {
+	if !file.Mode.IsRegular() {
+		return nil, fmt.Errorf("vac: %s is not a regular file", file.Name)
+	}
+	return jupiter.NewObjectReader(j, file.Score)
+}
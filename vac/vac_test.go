@@ -0,0 +1,176 @@
+package vac
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespedes/jupiter"
+)
+
+func TestArchiveRestore(t *testing.T) {
+	src, err := ioutil.TempDir("", "vac-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "vac-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	big := bytes.Repeat([]byte("0123456789"), 10000)
+	os.MkdirAll(filepath.Join(src, "a", "b"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a", "b", "big"), big, 0640)
+	ioutil.WriteFile(filepath.Join(src, "a", "empty"), nil, 0600)
+	ioutil.WriteFile(filepath.Join(src, "hello"), []byte("hello, world\n"), 0644)
+	os.Symlink("a/b/big", filepath.Join(src, "link"))
+
+	j, err := jupiter.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(j)
+	score, err := w.Archive(src)
+	if err != nil {
+		t.Fatalf("Archive(): %v", err)
+	}
+	t.Log(w.Stats())
+	if err := Restore(j, score, dst); err != nil {
+		t.Fatalf("Restore(): %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "big"))
+	if err != nil || !bytes.Equal(b, big) {
+		t.Errorf("a/b/big: contents differ (%v)", err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dst, "hello"))
+	if err != nil || string(b) != "hello, world\n" {
+		t.Errorf("hello: contents differ (%v)", err)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "a", "b", "big"))
+	if err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("a/b/big: wrong mode (%v)", err)
+	}
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	if err != nil || target != "a/b/big" {
+		t.Errorf("link: target is %q (%v)", target, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "a", "empty")); err != nil || fi.Size() != 0 {
+		t.Errorf("a/empty: %v", err)
+	}
+
+	// an exported snapshot can be restored from another store
+	var buf bytes.Buffer
+	e, err := jupiter.NewExporter(&buf, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(e, j, score); err != nil {
+		t.Fatalf("Export(): %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	j2, _ := jupiter.New()
+	if _, err := jupiter.Import(&buf, j2); err != nil {
+		t.Fatalf("Import(): %v", err)
+	}
+	dst2 := filepath.Join(dst, "copy")
+	if err := Restore(j2, score, dst2); err != nil {
+		t.Fatalf("Restore() of an imported snapshot: %v", err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dst2, "a", "b", "big"))
+	if err != nil || !bytes.Equal(b, big) {
+		t.Errorf("imported a/b/big: contents differ (%v)", err)
+	}
+}
+
+// hostileDir stores a directory with the given entries, without checking them
+func hostileDir(t *testing.T, j *jupiter.Jupiter, name string, entries ...*Entry) *Entry {
+	ow := jupiter.NewObjectWriter(j)
+	for _, e := range entries {
+		ow.Write(e.appendTo(nil))
+	}
+	if err := ow.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &Entry{Name: name, Mode: os.ModeDir | 0755, Score: ow.Score()}
+}
+
+func TestRestoreHostile(t *testing.T) {
+	dst, err := ioutil.TempDir("", "vac-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	outside := filepath.Join(dst, "outside")
+	os.Mkdir(outside, 0755)
+
+	j, err := jupiter.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow := jupiter.NewObjectWriter(j)
+	ow.Write([]byte("pwned"))
+	ow.Close()
+	file := &Entry{Name: "file", Mode: 0644, Size: 5, Score: ow.Score()}
+	link := &Entry{Name: "evil", Mode: os.ModeSymlink | 0777, Target: outside}
+
+	for _, test := range []struct {
+		name string
+		root *Entry
+	}{
+		{"symlink and directory with the same name", hostileDir(t, j, "", link, hostileDir(t, j, "evil", file))},
+		{"symlink and file with the same name", hostileDir(t, j, "", link, &Entry{Name: "evil", Mode: 0644, Score: file.Score})},
+	} {
+		score, err := writeRoot(j, &Root{Entry: test.root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(dst, test.name)
+		if err := Restore(j, score, dir); err == nil {
+			t.Errorf("%s: Restore() succeeded", test.name)
+		}
+	}
+
+	// a symbolic link already in the destination is not followed
+	dir := filepath.Join(dst, "existing")
+	os.Mkdir(dir, 0755)
+	os.Symlink(outside, filepath.Join(dir, "evil"))
+	score, err := writeRoot(j, &Root{Entry: hostileDir(t, j, "", hostileDir(t, j, "evil", file))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(j, score, dir); err == nil {
+		t.Errorf("Restore() over a symbolic link succeeded")
+	}
+	os.Remove(filepath.Join(dir, "evil"))
+	os.Symlink(filepath.Join(outside, "file"), filepath.Join(dir, "file"))
+	score, err = writeRoot(j, &Root{Entry: hostileDir(t, j, "", file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(j, score, dir); err == nil {
+		t.Errorf("Restore() of a file over a symbolic link succeeded")
+	}
+
+	if list, _ := ioutil.ReadDir(outside); len(list) != 0 {
+		t.Errorf("Restore() wrote %d files outside of its directory", len(list))
+	}
+
+	// a symbolic link listed before its siblings is created after them
+	dir = filepath.Join(dst, "order")
+	score, err = writeRoot(j, &Root{Entry: hostileDir(t, j, "", &Entry{Name: "a", Mode: os.ModeSymlink | 0777, Target: "file"}, file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(j, score, dir); err != nil {
+		t.Fatalf("Restore(): %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "a")); err != nil || string(b) != "pwned" {
+		t.Errorf("a: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,373 @@
+package vacfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 9P2000 message types
+const (
+	Tversion = 100 + iota
+	Rversion
+	Tauth
+	Rauth
+	Tattach
+	Rattach
+	Terror // illegal
+	Rerror
+	Tflush
+	Rflush
+	Twalk
+	Rwalk
+	Topen
+	Ropen
+	Tcreate
+	Rcreate
+	Tread
+	Rread
+	Twrite
+	Rwrite
+	Tclunk
+	Rclunk
+	Tremove
+	Rremove
+	Tstat
+	Rstat
+	Twstat
+	Rwstat
+)
+
+const (
+	NoTag = 0xFFFF
+	NoFid = 0xFFFFFFFF
+
+	QTDIR  = 0x80
+	QTFILE = 0x00
+
+	DMDIR = 0x80000000
+
+	OREAD   = 0
+	OWRITE  = 1
+	ORDWR   = 2
+	OEXEC   = 3
+	OTRUNC  = 0x10
+	ORCLOSE = 0x40
+
+	IOHDRSZ = 24 // size of the header of Rread and Twrite messages
+	MaxWalk = 16 // maximum number of elements in a Twalk
+)
+
+var errShort = errors.New("9p: message too short")
+
+// A Qid identifies a file in the server.
+type Qid struct {
+	Type uint8
+	Vers uint32
+	Path uint64
+}
+
+// A Dir is the information returned by Tstat, and by reading a directory.
+type Dir struct {
+	Type   uint16
+	Dev    uint32
+	Qid    Qid
+	Mode   uint32
+	Atime  uint32
+	Mtime  uint32
+	Length uint64
+	Name   string
+	Uid    string
+	Gid    string
+	Muid   string
+}
+
+// A Fcall is a 9P message.  Only the fields used by its type are meaningful.
+type Fcall struct {
+	Type    uint8
+	Tag     uint16
+	Fid     uint32
+	Msize   uint32 // Tversion, Rversion
+	Version string // Tversion, Rversion
+	Oldtag  uint16 // Tflush
+	Ename   string // Rerror
+	Qid     Qid    // Rattach, Ropen, Rcreate
+	Iounit  uint32 // Ropen, Rcreate
+	Afid    uint32 // Tauth, Tattach
+	Uname   string // Tauth, Tattach
+	Aname   string // Tauth, Tattach
+	Perm    uint32 // Tcreate
+	Name    string // Tcreate
+	Mode    uint8  // Tcreate, Topen
+	Newfid  uint32 // Twalk
+	Wname   []string
+	Wqid    []Qid  // Rwalk
+	Offset  uint64 // Tread, Twrite
+	Count   uint32 // Tread, Twrite
+	Data    []byte // Twrite, Rread
+	Stat    []byte // Twstat, Rstat
+}
+
+// buffer encodes 9P messages
+type buffer []byte
+
+func (b *buffer) u8(v uint8)   { *b = append(*b, v) }
+func (b *buffer) u16(v uint16) { *b = append(*b, byte(v), byte(v>>8)) }
+func (b *buffer) u32(v uint32) { *b = append(*b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+func (b *buffer) u64(v uint64) { b.u32(uint32(v)); b.u32(uint32(v >> 32)) }
+func (b *buffer) str(s string) { b.u16(uint16(len(s))); *b = append(*b, s...) }
+func (b *buffer) qid(q Qid)    { b.u8(q.Type); b.u32(q.Vers); b.u64(q.Path) }
+func (b *buffer) data(d []byte) {
+	b.u32(uint32(len(d)))
+	*b = append(*b, d...)
+}
+
+// decoder decodes 9P messages
+type decoder struct {
+	b   []byte
+	err error
+}
+
+// next returns the next n bytes of the message.  If there are not
+// enough, it sets d.err and returns zeros for the fixed-size fields.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		d.err = errShort
+		if n < 0 || n > 8 {
+			return nil
+		}
+		return make([]byte, n)
+	}
+	r := d.b[:n]
+	d.b = d.b[n:]
+	return r
+}
+
+func (d *decoder) u8() uint8   { return d.next(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.next(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.next(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.next(8)) }
+func (d *decoder) str() string { return string(d.next(int(d.u16()))) }
+func (d *decoder) qid() Qid {
+	return Qid{Type: d.u8(), Vers: d.u32(), Path: d.u64()}
+}
+
+// MarshalDir encodes the information of a file, as returned by Tstat
+func MarshalDir(dir *Dir) []byte {
+	var b buffer
+	b.u16(0) // size, filled in later
+	b.u16(dir.Type)
+	b.u32(dir.Dev)
+	b.qid(dir.Qid)
+	b.u32(dir.Mode)
+	b.u32(dir.Atime)
+	b.u32(dir.Mtime)
+	b.u64(dir.Length)
+	b.str(dir.Name)
+	b.str(dir.Uid)
+	b.str(dir.Gid)
+	b.str(dir.Muid)
+	binary.LittleEndian.PutUint16(b, uint16(len(b)-2))
+	return b
+}
+
+// UnmarshalDir decodes the information of a file
+func UnmarshalDir(b []byte) (*Dir, error) {
+	d := decoder{b: b}
+	if int(d.u16()) != len(b)-2 {
+		return nil, fmt.Errorf("9p: invalid stat size")
+	}
+	dir := &Dir{
+		Type:   d.u16(),
+		Dev:    d.u32(),
+		Qid:    d.qid(),
+		Mode:   d.u32(),
+		Atime:  d.u32(),
+		Mtime:  d.u32(),
+		Length: d.u64(),
+		Name:   d.str(),
+		Uid:    d.str(),
+		Gid:    d.str(),
+		Muid:   d.str(),
+	}
+	return dir, d.err
+}
+
+// Marshal encodes a 9P message
+func (f *Fcall) Marshal() []byte {
+	var b buffer
+	b.u32(0) // size, filled in later
+	b.u8(f.Type)
+	b.u16(f.Tag)
+	switch f.Type {
+	case Tversion, Rversion:
+		b.u32(f.Msize)
+		b.str(f.Version)
+	case Tauth:
+		b.u32(f.Afid)
+		b.str(f.Uname)
+		b.str(f.Aname)
+	case Rauth, Rattach:
+		b.qid(f.Qid)
+	case Tattach:
+		b.u32(f.Fid)
+		b.u32(f.Afid)
+		b.str(f.Uname)
+		b.str(f.Aname)
+	case Rerror:
+		b.str(f.Ename)
+	case Tflush:
+		b.u16(f.Oldtag)
+	case Twalk:
+		b.u32(f.Fid)
+		b.u32(f.Newfid)
+		b.u16(uint16(len(f.Wname)))
+		for _, n := range f.Wname {
+			b.str(n)
+		}
+	case Rwalk:
+		b.u16(uint16(len(f.Wqid)))
+		for _, q := range f.Wqid {
+			b.qid(q)
+		}
+	case Topen:
+		b.u32(f.Fid)
+		b.u8(f.Mode)
+	case Ropen, Rcreate:
+		b.qid(f.Qid)
+		b.u32(f.Iounit)
+	case Tcreate:
+		b.u32(f.Fid)
+		b.str(f.Name)
+		b.u32(f.Perm)
+		b.u8(f.Mode)
+	case Tread:
+		b.u32(f.Fid)
+		b.u64(f.Offset)
+		b.u32(f.Count)
+	case Rread:
+		b.data(f.Data)
+	case Twrite:
+		b.u32(f.Fid)
+		b.u64(f.Offset)
+		b.data(f.Data)
+	case Rwrite:
+		b.u32(f.Count)
+	case Tclunk, Tremove, Tstat:
+		b.u32(f.Fid)
+	case Rstat:
+		b.u16(uint16(len(f.Stat)))
+		b = append(b, f.Stat...)
+	case Twstat:
+		b.u32(f.Fid)
+		b.u16(uint16(len(f.Stat)))
+		b = append(b, f.Stat...)
+	}
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// Unmarshal decodes a 9P message (without its size)
+func Unmarshal(b []byte) (*Fcall, error) {
+	d := decoder{b: b}
+	f := &Fcall{Type: d.u8(), Tag: d.u16()}
+	switch f.Type {
+	case Tversion, Rversion:
+		f.Msize = d.u32()
+		f.Version = d.str()
+	case Tauth:
+		f.Afid = d.u32()
+		f.Uname = d.str()
+		f.Aname = d.str()
+	case Rauth, Rattach:
+		f.Qid = d.qid()
+	case Tattach:
+		f.Fid = d.u32()
+		f.Afid = d.u32()
+		f.Uname = d.str()
+		f.Aname = d.str()
+	case Rerror:
+		f.Ename = d.str()
+	case Tflush:
+		f.Oldtag = d.u16()
+	case Twalk:
+		f.Fid = d.u32()
+		f.Newfid = d.u32()
+		n := d.u16()
+		if n > MaxWalk {
+			return nil, fmt.Errorf("9p: too many elements in Twalk")
+		}
+		for i := 0; i < int(n); i++ {
+			f.Wname = append(f.Wname, d.str())
+		}
+	case Rwalk:
+		n := d.u16()
+		if n > MaxWalk {
+			return nil, fmt.Errorf("9p: too many elements in Rwalk")
+		}
+		for i := 0; i < int(n); i++ {
+			f.Wqid = append(f.Wqid, d.qid())
+		}
+	case Topen:
+		f.Fid = d.u32()
+		f.Mode = d.u8()
+	case Ropen, Rcreate:
+		f.Qid = d.qid()
+		f.Iounit = d.u32()
+	case Tcreate:
+		f.Fid = d.u32()
+		f.Name = d.str()
+		f.Perm = d.u32()
+		f.Mode = d.u8()
+	case Tread:
+		f.Fid = d.u32()
+		f.Offset = d.u64()
+		f.Count = d.u32()
+	case Rread:
+		f.Data = d.next(int(d.u32()))
+	case Twrite:
+		f.Fid = d.u32()
+		f.Offset = d.u64()
+		f.Data = d.next(int(d.u32()))
+	case Rwrite:
+		f.Count = d.u32()
+	case Tclunk, Tremove, Tstat:
+		f.Fid = d.u32()
+	case Rstat:
+		f.Stat = d.next(int(d.u16()))
+	case Twstat:
+		f.Fid = d.u32()
+		f.Stat = d.next(int(d.u16()))
+	case Rflush, Rclunk, Rremove, Rwstat:
+	default:
+		return nil, fmt.Errorf("9p: unknown message type %d", f.Type)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return f, nil
+}
+
+// ReadFcall reads a 9P message of at most msize bytes
+func ReadFcall(r io.Reader, msize uint32) (*Fcall, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 7 || n > msize {
+		return nil, fmt.Errorf("9p: invalid message size %d", n)
+	}
+	b := make([]byte, n-4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return Unmarshal(b)
+}
+
+// WriteFcall writes a 9P message
+func WriteFcall(w io.Writer, f *Fcall) error {
+	_, err := w.Write(f.Marshal())
+	return err
+}
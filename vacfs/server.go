@@ -0,0 +1,355 @@
+// Package vacfs serves a vac snapshot as a read-only file system, using the
+// 9P2000 protocol.
+//
+// Directories and files are read lazily from the store, when they are
+// walked to or read.  On Linux, the file system can be mounted with the
+// v9fs kernel client:
+//
+//	mount -t 9p -o trans=tcp,port=5640,version=9p2000,ro 127.0.0.1 /mnt
+//
+// 9P2000 has no symbolic links, so they are served as regular files whose
+// contents are the target of the link.
+package vacfs
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cespedes/jupiter"
+	"github.com/cespedes/jupiter/vac"
+)
+
+const maxMsize = 64 * 1024
+
+var (
+	errReadOnly   = errors.New("read-only file system")
+	errNoAuth     = errors.New("authentication not required")
+	errUnknownFid = errors.New("unknown fid")
+	errFidInUse   = errors.New("fid already in use")
+	errNotFound   = errors.New("file does not exist")
+	errNotDir     = errors.New("not a directory")
+	errIsOpen     = errors.New("fid is open")
+	errNotOpen    = errors.New("fid is not open")
+	errBadMode    = errors.New("permission denied")
+	errBadMsg     = errors.New("unexpected message")
+)
+
+// A Server serves a vac snapshot with the 9P2000 protocol.
+type Server struct {
+	r jupiter.BlockReader
+
+	mu       sync.Mutex // protects the tree of nodes
+	root     *node
+	lastPath uint64
+}
+
+// A node is a file in the tree.  Its children are read when needed.
+type node struct {
+	entry    *vac.Entry
+	parent   *node
+	qid      Qid
+	loaded   bool
+	children []*node
+}
+
+// NewServer returns a Server for the snapshot with a given root score.
+// Blocks are read from r, which would usually be a jupiter.BlockCache.
+func NewServer(r jupiter.BlockReader, score jupiter.Score) (*Server, error) {
+	root, err := vac.ReadRoot(r, score)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{r: r}
+	s.root = s.newNode(root.Entry, nil)
+	s.root.entry.Name = "/"
+	s.root.parent = s.root
+	return s, nil
+}
+
+func (s *Server) newNode(e *vac.Entry, parent *node) *node {
+	s.lastPath++
+	n := &node{entry: e, parent: parent}
+	n.qid.Path = s.lastPath
+	if e.Mode.IsDir() {
+		n.qid.Type = QTDIR
+	}
+	return n
+}
+
+// child returns the child of a directory with a given name
+func (s *Server) child(n *node, name string) (*node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !n.entry.Mode.IsDir() {
+		return nil, errNotDir
+	}
+	if name == ".." {
+		return n.parent, nil
+	}
+	if err := s.load(n); err != nil {
+		return nil, err
+	}
+	for _, c := range n.children {
+		if c.entry.Name == name {
+			return c, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// load reads the entries of a directory.  s.mu must be held.
+func (s *Server) load(n *node) error {
+	if n.loaded {
+		return nil
+	}
+	entries, err := vac.ReadDir(s.r, n.entry)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		n.children = append(n.children, s.newNode(e, n))
+	}
+	n.loaded = true
+	return nil
+}
+
+// stat returns the 9P description of a node
+func (n *node) stat() *Dir {
+	e := n.entry
+	d := &Dir{
+		Qid:   n.qid,
+		Mode:  uint32(e.Mode.Perm()),
+		Atime: uint32(e.ModTime.Unix()),
+		Mtime: uint32(e.ModTime.Unix()),
+		Name:  e.Name,
+		Uid:   strconv.Itoa(int(e.Uid)),
+		Gid:   strconv.Itoa(int(e.Gid)),
+		Muid:  strconv.Itoa(int(e.Uid)),
+	}
+	if e.Mode.IsDir() {
+		d.Mode |= DMDIR
+	} else {
+		d.Length = e.Size
+	}
+	return d
+}
+
+// Serve accepts connections on a listener, and serves each one in
+// a new goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+type conn struct {
+	s     *Server
+	msize uint32
+	fids  map[uint32]*fid
+}
+
+type fid struct {
+	node *node
+	open bool
+	dir  []byte      // contents of an open directory
+	file io.ReaderAt // contents of an open file
+}
+
+// ServeConn serves 9P requests from a single connection, until it is
+// closed or there is a protocol error.
+func (s *Server) ServeConn(rw io.ReadWriteCloser) error {
+	defer rw.Close()
+	c := &conn{s: s, msize: maxMsize, fids: make(map[uint32]*fid)}
+	for {
+		t, err := ReadFcall(rw, c.msize)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		r, err := c.handle(t)
+		if err != nil {
+			r = &Fcall{Type: Rerror, Ename: err.Error()}
+		}
+		r.Tag = t.Tag
+		if err := WriteFcall(rw, r); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *conn) handle(t *Fcall) (*Fcall, error) {
+	switch t.Type {
+	case Tversion:
+		return c.version(t)
+	case Tauth:
+		return nil, errNoAuth
+	case Tattach:
+		return c.attach(t)
+	case Tflush:
+		// requests are answered in order, so there is nothing to flush
+		return &Fcall{Type: Rflush}, nil
+	case Twalk:
+		return c.walk(t)
+	case Topen:
+		return c.open(t)
+	case Tread:
+		return c.read(t)
+	case Tclunk:
+		if _, ok := c.fids[t.Fid]; !ok {
+			return nil, errUnknownFid
+		}
+		delete(c.fids, t.Fid)
+		return &Fcall{Type: Rclunk}, nil
+	case Tremove:
+		delete(c.fids, t.Fid)
+		return nil, errReadOnly
+	case Tstat:
+		f, ok := c.fids[t.Fid]
+		if !ok {
+			return nil, errUnknownFid
+		}
+		return &Fcall{Type: Rstat, Stat: MarshalDir(f.node.stat())}, nil
+	case Tcreate, Twrite, Twstat:
+		return nil, errReadOnly
+	}
+	return nil, errBadMsg
+}
+
+func (c *conn) version(t *Fcall) (*Fcall, error) {
+	if t.Msize < IOHDRSZ+1 {
+		return nil, errors.New("msize too small")
+	}
+	c.msize = t.Msize
+	if c.msize > maxMsize {
+		c.msize = maxMsize
+	}
+	c.fids = make(map[uint32]*fid)
+	version := "unknown"
+	if strings.HasPrefix(t.Version, "9P2000") {
+		version = "9P2000"
+	}
+	return &Fcall{Type: Rversion, Msize: c.msize, Version: version}, nil
+}
+
+func (c *conn) attach(t *Fcall) (*Fcall, error) {
+	if t.Afid != NoFid {
+		return nil, errNoAuth
+	}
+	if _, ok := c.fids[t.Fid]; ok {
+		return nil, errFidInUse
+	}
+	c.fids[t.Fid] = &fid{node: c.s.root}
+	return &Fcall{Type: Rattach, Qid: c.s.root.qid}, nil
+}
+
+func (c *conn) walk(t *Fcall) (*Fcall, error) {
+	f, ok := c.fids[t.Fid]
+	if !ok {
+		return nil, errUnknownFid
+	}
+	if f.open {
+		return nil, errIsOpen
+	}
+	if _, ok := c.fids[t.Newfid]; ok && t.Newfid != t.Fid {
+		return nil, errFidInUse
+	}
+	n := f.node
+	r := &Fcall{Type: Rwalk}
+	for _, name := range t.Wname {
+		child, err := c.s.child(n, name)
+		if err != nil {
+			if len(r.Wqid) == 0 {
+				return nil, err
+			}
+			// partial walk: newfid is not affected
+			return r, nil
+		}
+		n = child
+		r.Wqid = append(r.Wqid, n.qid)
+	}
+	c.fids[t.Newfid] = &fid{node: n}
+	return r, nil
+}
+
+func (c *conn) open(t *Fcall) (*Fcall, error) {
+	f, ok := c.fids[t.Fid]
+	if !ok {
+		return nil, errUnknownFid
+	}
+	if f.open {
+		return nil, errIsOpen
+	}
+	if mode := t.Mode & 3; (mode != OREAD && mode != OEXEC) || t.Mode&(OTRUNC|ORCLOSE) != 0 {
+		return nil, errBadMode
+	}
+	e := f.node.entry
+	switch {
+	case e.Mode.IsDir():
+		c.s.mu.Lock()
+		err := c.s.load(f.node)
+		children := f.node.children
+		c.s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			f.dir = append(f.dir, MarshalDir(child.stat())...)
+		}
+	case e.Mode.IsRegular():
+		r, err := vac.Open(c.s.r, e)
+		if err != nil {
+			return nil, err
+		}
+		f.file = r
+	default:
+		f.file = strings.NewReader(e.Target)
+	}
+	f.open = true
+	return &Fcall{Type: Ropen, Qid: f.node.qid, Iounit: c.msize - IOHDRSZ}, nil
+}
+
+func (c *conn) read(t *Fcall) (*Fcall, error) {
+	f, ok := c.fids[t.Fid]
+	if !ok {
+		return nil, errUnknownFid
+	}
+	if !f.open {
+		return nil, errNotOpen
+	}
+	count := t.Count
+	if count > c.msize-IOHDRSZ {
+		count = c.msize - IOHDRSZ
+	}
+	if f.file == nil {
+		// directory: return only whole entries
+		if t.Offset >= uint64(len(f.dir)) {
+			return &Fcall{Type: Rread}, nil
+		}
+		b := f.dir[t.Offset:]
+		n := 0
+		for n+2 <= len(b) {
+			size := 2 + int(b[n]) + int(b[n+1])<<8
+			if n+size > int(count) {
+				break
+			}
+			n += size
+		}
+		return &Fcall{Type: Rread, Data: b[:n]}, nil
+	}
+	b := make([]byte, count)
+	n, err := f.file.ReadAt(b, int64(t.Offset))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &Fcall{Type: Rread, Data: b[:n]}, nil
+}
@@ -0,0 +1,164 @@
+package vacfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/cespedes/jupiter"
+	"github.com/cespedes/jupiter/vac"
+)
+
+type client struct {
+	t  *testing.T
+	rw net.Conn
+}
+
+func (c *client) rpc(f *Fcall) *Fcall {
+	if err := WriteFcall(c.rw, f); err != nil {
+		c.t.Fatalf("WriteFcall(): %v", err)
+	}
+	r, err := ReadFcall(c.rw, maxMsize)
+	if err != nil {
+		c.t.Fatalf("ReadFcall(): %v", err)
+	}
+	return r
+}
+
+func TestServer(t *testing.T) {
+	src, err := ioutil.TempDir("", "vacfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	big := bytes.Repeat([]byte("abcdefghij"), 20000)
+	os.MkdirAll(filepath.Join(src, "a", "b"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a", "b", "big"), big, 0644)
+	ioutil.WriteFile(filepath.Join(src, "hello"), []byte("hello\n"), 0644)
+
+	j, err := jupiter.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, err := vac.NewWriter(j).Archive(src)
+	if err != nil {
+		t.Fatalf("Archive(): %v", err)
+	}
+	s, err := NewServer(jupiter.NewBlockCache(j, 1<<20), score)
+	if err != nil {
+		t.Fatalf("NewServer(): %v", err)
+	}
+	c1, c2 := net.Pipe()
+	go s.ServeConn(c2)
+	defer c1.Close()
+	c := &client{t: t, rw: c1}
+
+	r := c.rpc(&Fcall{Type: Tversion, Tag: NoTag, Msize: 8192, Version: "9P2000"})
+	if r.Type != Rversion || r.Version != "9P2000" || r.Msize != 8192 {
+		t.Fatalf("Tversion: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Tattach, Tag: 1, Fid: 0, Afid: NoFid, Uname: "test"})
+	if r.Type != Rattach || r.Qid.Type != QTDIR {
+		t.Fatalf("Tattach: got %+v", r)
+	}
+
+	// list the root directory
+	r = c.rpc(&Fcall{Type: Twalk, Tag: 1, Fid: 0, Newfid: 1})
+	if r.Type != Rwalk {
+		t.Fatalf("Twalk: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Topen, Tag: 1, Fid: 1, Mode: OREAD})
+	if r.Type != Ropen {
+		t.Fatalf("Topen: got %+v", r)
+	}
+	var names []string
+	for off := uint64(0); ; {
+		r = c.rpc(&Fcall{Type: Tread, Tag: 1, Fid: 1, Offset: off, Count: 100})
+		if r.Type != Rread {
+			t.Fatalf("Tread: got %+v", r)
+		}
+		if len(r.Data) == 0 {
+			break
+		}
+		off += uint64(len(r.Data))
+		for b := r.Data; len(b) > 0; {
+			size := 2 + int(b[0]) + int(b[1])<<8
+			d, err := UnmarshalDir(b[:size])
+			if err != nil {
+				t.Fatalf("UnmarshalDir(): %v", err)
+			}
+			names = append(names, d.Name)
+			b = b[size:]
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a" || names[1] != "hello" {
+		t.Errorf("root directory has %q", names)
+	}
+
+	// read a file
+	r = c.rpc(&Fcall{Type: Twalk, Tag: 1, Fid: 0, Newfid: 2, Wname: []string{"a", "b", "big"}})
+	if r.Type != Rwalk || len(r.Wqid) != 3 {
+		t.Fatalf("Twalk: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Tstat, Tag: 1, Fid: 2})
+	d, err := UnmarshalDir(r.Stat)
+	if r.Type != Rstat || err != nil || d.Length != uint64(len(big)) || d.Mode != 0644 {
+		t.Fatalf("Tstat: got %+v (%v)", d, err)
+	}
+	r = c.rpc(&Fcall{Type: Topen, Tag: 1, Fid: 2, Mode: OREAD})
+	if r.Type != Ropen {
+		t.Fatalf("Topen: got %+v", r)
+	}
+	iounit := r.Iounit
+	var data []byte
+	for {
+		r = c.rpc(&Fcall{Type: Tread, Tag: 1, Fid: 2, Offset: uint64(len(data)), Count: iounit})
+		if r.Type != Rread {
+			t.Fatalf("Tread: got %+v", r)
+		}
+		if len(r.Data) == 0 {
+			break
+		}
+		data = append(data, r.Data...)
+	}
+	if !bytes.Equal(data, big) {
+		t.Errorf("a/b/big: contents differ")
+	}
+
+	// errors
+	r = c.rpc(&Fcall{Type: Twalk, Tag: 1, Fid: 0, Newfid: 3, Wname: []string{"nonexistent"}})
+	if r.Type != Rerror {
+		t.Errorf("Twalk to nonexistent file: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Twalk, Tag: 1, Fid: 0, Newfid: 3, Wname: []string{"a", "nonexistent"}})
+	if r.Type != Rwalk || len(r.Wqid) != 1 {
+		t.Errorf("partial Twalk: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Twrite, Tag: 1, Fid: 2, Data: []byte("x")})
+	if r.Type != Rerror {
+		t.Errorf("Twrite: got %+v", r)
+	}
+	r = c.rpc(&Fcall{Type: Tclunk, Tag: 1, Fid: 2})
+	if r.Type != Rclunk {
+		t.Errorf("Tclunk: got %+v", r)
+	}
+}
+
+func TestUnmarshalShort(t *testing.T) {
+	// a Twrite which claims to carry 4 GiB of data
+	b := (&Fcall{Type: Twrite, Tag: 1, Fid: 2, Data: []byte("x")}).Marshal()[4:]
+	copy(b[len(b)-5:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := Unmarshal(b); err != errShort {
+		t.Errorf("Unmarshal(): %v, want %v", err, errShort)
+	}
+	for n := 0; n < len(b); n++ {
+		if _, err := Unmarshal(b[:n]); err == nil {
+			t.Errorf("Unmarshal() of %d bytes should fail", n)
+		}
+	}
+}
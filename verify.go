@@ -0,0 +1,90 @@
+package jupiter
+
+import (
+	"context"
+	"io"
+)
+
+// maxVerifyBatch is the number of bytes of blocks checked by Verify
+// each time it takes the lock of the Jupiter
+const maxVerifyBatch = 1 << 20
+
+// VerifyResult is the result of Verify.  Corrupt has a CorruptionError
+// for every block that could not be read, or that is not in the index.
+type VerifyResult struct {
+	Blocks  int
+	Bytes   uint64
+	Corrupt []*CorruptionError
+}
+
+// Verify reads every block in the data log, checking that its contents
+// match its score and that it can be found with the index.
+// Other blocks can be written while it runs; the ones written after it
+// reaches the end of the data log are not checked.
+// It stops when the context is done, returning what it found so far and
+// the error of the context.
+func (j *Jupiter) Verify(ctx context.Context) (VerifyResult, error) {
+	var res VerifyResult
+	from := uint64(dataLogHeaderSize)
+	for {
+		next, more, err := j.verify(ctx, from, &res)
+		if err != nil || !more {
+			return res, err
+		}
+		from = next
+	}
+}
+
+// verify checks the blocks from a given address, up to about
+// maxVerifyBatch bytes.  It returns the address of the next block,
+// and whether there are more blocks to check.
+func (j *Jupiter) verify(ctx context.Context, from uint64, res *VerifyResult) (uint64, bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	next, size := from, 0
+	err := j.datalog.Walk(from, func(addr uint64, s Score, t Type, n int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if size > 0 && size+n > maxVerifyBatch {
+			return errBatchFull
+		}
+		if _, _, err := j.datalog.ReadChunk(s, addr); err != nil {
+			cerr, ok := err.(*CorruptionError)
+			if !ok {
+				return err
+			}
+			res.Corrupt = append(res.Corrupt, cerr)
+		} else if !j.indexed(s, addr) {
+			res.Corrupt = append(res.Corrupt, &CorruptionError{Addr: addr, Score: s, Reason: "block is not in the index"})
+		}
+		res.Blocks++
+		res.Bytes += uint64(n)
+		next = addr + chunkHeaderSize + uint64(n)
+		size += n
+		return nil
+	})
+	switch err {
+	case errBatchFull:
+		return next, true, nil
+	case io.ErrUnexpectedEOF:
+		res.Corrupt = append(res.Corrupt, &CorruptionError{Addr: next, Reason: "incomplete block at end of data log"})
+		return next, false, nil
+	}
+	return next, false, err
+}
+
+// indexed reports whether a lookup of a score finds a given address.
+// j.mu must be held.
+func (j *Jupiter) indexed(score Score, addr uint64) bool {
+	addrs, err := j.lookup(score)
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
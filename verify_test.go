@@ -0,0 +1,94 @@
+package jupiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jupiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Config{BucketSize: BlockSize, FPSize: ScoreBytesInEntry, DataLogFiles: []string{filepath.Join(dir, "data.log")}}
+	j, err := Open(c)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	defer j.Close()
+	for i := 0; i < 1000; i++ {
+		if _, err := j.Write(1, []byte(fmt.Sprintf("block %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// more than one batch
+	big := make([]byte, MaxChunkSize)
+	for i := 0; i < 20; i++ {
+		big[0] = byte(i)
+		if _, err := j.Write(2, big); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := j.Verify(context.Background())
+	if err != nil || res.Blocks != 1020 || len(res.Corrupt) != 0 {
+		t.Fatalf("Verify() = %d blocks, %v, %v", res.Blocks, res.Corrupt, err)
+	}
+
+	// change the last byte of the last block, and append half a block
+	s, _ := j.Write(1, []byte("hello, world"))
+	f, err := os.OpenFile(c.DataLogFiles[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := f.Stat()
+	f.WriteAt([]byte("D"), fi.Size()-1)
+	f.WriteAt(make([]byte, 20), fi.Size())
+	f.Close()
+	res, err = j.Verify(context.Background())
+	if err != nil || res.Blocks != 1021 || len(res.Corrupt) != 2 {
+		t.Fatalf("Verify() after corruption = %d blocks, %v, %v", res.Blocks, res.Corrupt, err)
+	}
+	if !res.Corrupt[0].Score.Equal(s) || res.Corrupt[1].Addr != uint64(fi.Size()) {
+		t.Errorf("Verify() found %v", res.Corrupt)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res, err := j.Verify(ctx); !errors.Is(err, context.Canceled) || res.Blocks != 0 {
+		t.Errorf("Verify() with a canceled context = %d blocks, %v", res.Blocks, err)
+	}
+	if _, err := OpenContext(ctx, c); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenContext() with a canceled context: %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	j, err := New()
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	s, err := j.WriteContext(context.Background(), 1, []byte("hello"))
+	if err != nil {
+		t.Fatalf("WriteContext(): %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := j.WriteContext(ctx, 1, []byte("not written")); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteContext() with a canceled context: %v", err)
+	}
+	if j.Has(GetScore([]byte("not written"))) {
+		t.Errorf("block written with a canceled context")
+	}
+	if _, _, err := j.ReadContext(ctx, s); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext() with a canceled context: %v", err)
+	}
+	if _, _, err := j.ReadContext(context.Background(), s); err != nil {
+		t.Errorf("ReadContext(): %v", err)
+	}
+}